@@ -0,0 +1,19 @@
+// Package autoinit initialize base with all features at importing
+//
+// Import it anonymously in main package to keep the behavior that base
+// sets up signals, memory watching, config and logger by itself:
+//
+//	import _ "github.com/miinowy/go-base/autoinit"
+//
+// It panics if config is rejected.
+package autoinit
+
+import (
+	"github.com/miinowy/go-base"
+)
+
+func init() {
+	if err := base.Init(base.Options{}); err != nil {
+		panic(err)
+	}
+}
@@ -1,4 +1,18 @@
 // Package base provide some base functions of GoLang
+//
+// Call Init at the beginning of main to set up signals, memory watching,
+// config and logger, or import package autoinit to do it at importing.
+// Packages built on base trigger Init lazily with library options, which
+// won't take over the host process.
+//
+// Config is merged from sources by precedence order, the former wins:
+//
+//  1. flags, `--set key=value` or flags named by key in FlagSet
+//  2. environment variables, e.g. `MYAPP_WEBSVR_API_LISTEN`
+//  3. config file, searched by name of app
+//  4. defaults
+//
+// All sources are merged again on every Reload.
 package base
 
 import (
@@ -16,17 +30,9 @@ import (
 	"github.com/spf13/viper"
 )
 
-// init
+// init only collects information of app, the rest is done by Init
 func init() {
 	inforTrigger()
-	sigerTrigger()
-	memorTrigger()
-
-	conferTrigger()
-	loggerTrigger()
-
-	// Initialize by Reload function
-	Reload()
 }
 
 var (
@@ -47,10 +53,20 @@ var (
 	buildTime string
 	buildDir  string
 
+	// Build information from runtime/debug.ReadBuildInfo
+	buildPath     string
+	buildMain     string
+	buildModified bool
+	buildDeps     []*debug.Module
+
 	// Functions to execute when reload
 	reloadFuncs sync.Map
+	// Config key prefixes subscribed by functions to execute when reload
+	reloadKeys sync.Map
 	// Functions to execute when retire
 	retireFuncs sync.Map
+	// Functions to validate config before it takes effect
+	validateFuncs sync.Map
 
 	// Avoid reload in parallel
 	reloadMtx sync.Mutex
@@ -116,14 +132,36 @@ func GetBuildDir() string {
 	return buildDir
 }
 
-// GetIP return outer IP of host
+// GetBuildPath return module path of main package
+func GetBuildPath() string {
+	return buildPath
+}
+
+// GetBuildModified return whether source code was modified at building
+func GetBuildModified() bool {
+	return buildModified
+}
+
+// GetBuildDeps return dependency modules at building
+func GetBuildDeps() []*debug.Module {
+	return buildDeps
+}
+
+// GetIP return the preferred IP of host, nil if no address available
+//
+// Address is picked from network interfaces without network access,
+// it could be adjusted by `ip.interface`, `ip.cidr` and `ip.ipv6` in config
 func GetIP() net.IP {
-	conn, err := net.Dial("udp", "1.1.1.1:53")
-	if err != nil {
-		return nil
+	if ips := GetIPs(); 0 < len(ips) {
+		return ips[0]
 	}
-	defer conn.Close()
-	return conn.LocalAddr().(*net.UDPAddr).IP
+	return nil
+}
+
+// GetIPs return all candidate IPs of host, sorted by preference
+func GetIPs() []net.IP {
+	neterTrigger()
+	return neterInstance.IPs()
 }
 
 // GetPath return the absolute path relative to the binary file by input
@@ -153,8 +191,15 @@ func IsLiteMode() bool {
 
 // SetLiteMode set whether it is in lite mode
 func SetLiteMode(mode bool) {
+	initTrigger()
+
+	old := isLiteMode
 	isLiteMode = mode
 	loggerInstance.adjustLogLevel()
+
+	if old != mode {
+		eventEmit(Event{Type: EventLiteModeChanged, Old: old, New: mode})
+	}
 }
 
 // LiverRegister is used to register a liver hunter
@@ -177,6 +222,17 @@ func ReloadRegister(function func() error, key string) {
 // ReloadCancel is used to cancel a function to be executed when reload
 func ReloadCancel(key string) {
 	reloadFuncs.Delete(key)
+	reloadKeys.Delete(key)
+}
+
+// ReloadSubscribe is used to subscribe config key prefixes by a function to be
+// executed when reload, it will be executed only if any key matched changed
+//
+// Prefix matches the key itself and keys under it, e.g. `websvr.api` matches
+// `websvr.api` and `websvr.api.listen`. Functions without subscription are
+// executed on every reload.
+func ReloadSubscribe(key string, prefixes ...string) {
+	reloadKeys.Store(key, prefixes)
 }
 
 // RetireRegister is used to register a function to be executed when retire
@@ -189,24 +245,58 @@ func RetireCancel(key string) {
 	retireFuncs.Delete(key)
 }
 
+// ValidateRegister is used to register a function to validate config before it takes effect
+//
+// Function will receive a staging viper that holds the new config, config
+// will be rejected and the previous one stays active if it returns an error
+func ValidateRegister(function func(*viper.Viper) error, key string) {
+	validateFuncs.Store(key, function)
+}
+
+// ValidateCancel is used to cancel a function to validate config
+func ValidateCancel(key string) {
+	validateFuncs.Delete(key)
+}
+
 // Daemon will retire current process and start a daemon process
 func Daemon() {
 	Retire(0, true)
 }
 
 // Reload configure and logger, and functions in reloadFuncs
-func Reload() {
+//
+// Nothing will be reloaded if new config was rejected, the error is returned
+func Reload() (err error) {
+	initTrigger()
+
 	reloadMtx.Lock()
 	defer reloadMtx.Unlock()
 
+	eventEmit(Event{Type: EventReloadBegin})
+	defer func() {
+		eventEmit(Event{Type: EventReloadEnd, Err: err})
+	}()
+
 	// configer and logger
-	conferTaskInstance.Fire()
+	if err = conferTaskInstance.Fire(); err != nil {
+		logrus.WithError(err).Error("Failed to load config, keep the previous one")
+		return err
+	}
 	loggerTaskInstance.Fire()
 
-	// reload functions
-	groupRun(&reloadFuncs, 10*time.Second)
+	// reload functions, subscriptions are filtered by changed keys
+	changed := conferInstance.Changed()
+	var functions sync.Map
+	reloadFuncs.Range(func(key, value interface{}) bool {
+		if prefixes, ok := reloadKeys.Load(key); ok == false || configMatch(changed, prefixes.([]string)) == true {
+			functions.Store(key, value)
+		}
+		return true
+	})
+	groupRun(&functions, 10*time.Second)
 
 	reloadAt = time.Now()
+	return nil
 }
 
 // Retire will execute all functions in retireFuncs and exit by code
@@ -223,12 +313,18 @@ func Retire(code int, args ...bool) {
 	if code != 0 && daemon == false {
 		logrus.WithFields(logrus.Fields{"exit_code": code}).
 			Error("Ops... Somebody called Retire() with a none zero exit code, call stack:\n", string(debug.Stack()))
+		ringDump()
 	}
 
+	eventEmit(Event{Type: EventRetireBegin, Code: code})
+
 	// retireFuncs
 	groupRun(&retireFuncs, 10*time.Second)
 
+	eventEmit(Event{Type: EventRetireEnd, Code: code})
+
 	if daemon == true {
+		eventEmit(Event{Type: EventDaemonRestart, Code: code})
 		logrus.Info("See you in daemon~")
 		cmd := exec.Command(os.Args[0], os.Args[1:]...)
 		cmd.Stderr = os.Stdout
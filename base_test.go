@@ -0,0 +1,28 @@
+package base
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+var testInitOnce sync.Once
+
+// testInit initialize base with logger enabled, without taking over process,
+// config file etc/test.yaml is found by searching
+func testInit(t *testing.T) {
+	testInitOnce.Do(func() {
+		viper.Set("log.file.enabled", false)
+		err := Init(Options{
+			NoSignal:      true,
+			NoMemor:       true,
+			NoVersion:     true,
+			NoFlags:       true,
+			NoConfigWatch: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
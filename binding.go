@@ -0,0 +1,224 @@
+package base
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// Binding of config, value under key is decoded into T and swapped on reload
+//
+// Fields of T are named by `mapstructure` tag, and support tags:
+//
+//	default:  default value if key is absent, e.g. `default:"10s"`
+//	validate: rules separated by `,`, supports required, min=N, max=N and
+//	          oneof=a b c. min and max limit length of strings, slices and maps
+//
+// New config that fails decoding or validation is rejected.
+type Binding[T any] struct {
+	key string
+	id  string
+
+	value atomic.Value
+
+	mtx   sync.Mutex
+	funcs []func(old, new T)
+}
+
+// BindConfig return a binding of config by key, whole config if key is empty
+func BindConfig[T any](key string) (*Binding[T], error) {
+	initTrigger()
+
+	b := &Binding[T]{key: key, id: fmt.Sprintf("binding/%s/%s", key, uuid.New().String())}
+	value, err := b.decode(viper.GetViper())
+	if err != nil {
+		return nil, err
+	}
+	b.value.Store(value)
+
+	ValidateRegister(func(v *viper.Viper) error {
+		_, err := b.decode(v)
+		return err
+	}, b.id)
+	ReloadRegister(b.reload, b.id)
+	if key != "" {
+		ReloadSubscribe(b.id, key)
+	}
+
+	return b, nil
+}
+
+// Get return current value
+func (b *Binding[T]) Get() T {
+	return b.value.Load().(T)
+}
+
+// OnChange register a function to be executed when value changed
+func (b *Binding[T]) OnChange(function func(old, new T)) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.funcs = append(b.funcs, function)
+}
+
+// Cancel stop updating value on reload
+func (b *Binding[T]) Cancel() {
+	ValidateCancel(b.id)
+	ReloadCancel(b.id)
+}
+
+func (b *Binding[T]) reload() error {
+	value, err := b.decode(viper.GetViper())
+	if err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	old := b.Get()
+	if reflect.DeepEqual(old, value) == true {
+		b.mtx.Unlock()
+		return nil
+	}
+	b.value.Store(value)
+	funcs := append([]func(old, new T){}, b.funcs...)
+	b.mtx.Unlock()
+
+	// Functions are executed after unlocking, so that they could use binding
+	for _, function := range funcs {
+		function(old, value)
+	}
+	return nil
+}
+
+// decode return value decoded from v, with defaults and validation
+func (b *Binding[T]) decode(v *viper.Viper) (value T, err error) {
+	rv := reflect.ValueOf(&value).Elem()
+	if err = bindingDefault(rv); err != nil {
+		return value, fmt.Errorf("Failed to set default of %v: %v", b.key, err)
+	}
+
+	if b.key == "" {
+		err = v.Unmarshal(&value)
+	} else if v.IsSet(b.key) == true {
+		err = v.UnmarshalKey(b.key, &value)
+	}
+	if err != nil {
+		return value, fmt.Errorf("Failed to decode config %v: %v", b.key, err)
+	}
+
+	if err = bindingValidate(rv, b.key); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// bindingDefault set fields of struct by `default` tag recursively
+func bindingDefault(rv reflect.Value) error {
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		field, sf := rv.Field(i), rv.Type().Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		if tag, ok := sf.Tag.Lookup("default"); ok == true {
+			// Decode by viper, so default values are parsed as config values
+			d := viper.New()
+			d.Set("default", tag)
+			if err := d.UnmarshalKey("default", field.Addr().Interface()); err != nil {
+				return fmt.Errorf("%v: %v", sf.Name, err)
+			}
+		} else if err := bindingDefault(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindingValidate check fields of struct by `validate` tag recursively
+func bindingValidate(rv reflect.Value, key string) error {
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		field, sf := rv.Field(i), rv.Type().Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := sf.Tag.Get("mapstructure")
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		if key != "" {
+			name = key + "." + name
+		}
+
+		for _, rule := range strings.Split(sf.Tag.Get("validate"), ",") {
+			if err := bindingRule(field, strings.TrimSpace(rule)); err != nil {
+				return fmt.Errorf("Invalid config %v: %v", name, err)
+			}
+		}
+		if err := bindingValidate(field, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindingRule check value by a validation rule
+func bindingRule(rv reflect.Value, rule string) error {
+	op, arg := rule, ""
+	if i := strings.Index(rule, "="); 0 <= i {
+		op, arg = rule[:i], rule[i+1:]
+	}
+
+	switch op {
+	case "":
+		return nil
+	case "required":
+		if rv.IsZero() == true {
+			return fmt.Errorf("required")
+		}
+		return nil
+	case "oneof":
+		value := fmt.Sprintf("%v", rv.Interface())
+		for _, option := range strings.Fields(arg) {
+			if option == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%v is not one of [%v]", value, arg)
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("bad rule %v", rule)
+		}
+		var n float64
+		switch rv.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+			n = float64(rv.Len())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = float64(rv.Uint())
+		case reflect.Float32, reflect.Float64:
+			n = rv.Float()
+		default:
+			return fmt.Errorf("bad rule %v for %v", rule, rv.Kind())
+		}
+		if op == "min" && n < limit {
+			return fmt.Errorf("%v is less than %v", rv.Interface(), arg)
+		}
+		if op == "max" && limit < n {
+			return fmt.Errorf("%v is greater than %v", rv.Interface(), arg)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown rule %v", rule)
+}
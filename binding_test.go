@@ -0,0 +1,116 @@
+package base
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// testBindingConfig is bound in tests
+type testBindingConfig struct {
+	Listen  string        `mapstructure:"listen" default:":8080" validate:"required"`
+	Timeout time.Duration `mapstructure:"timeout" default:"10s" validate:"min=1"`
+	Mode    string        `mapstructure:"mode" default:"fast" validate:"oneof=fast safe"`
+	Tags    []string      `mapstructure:"tags" validate:"max=2"`
+	Retry   struct {
+		Times int `mapstructure:"times" default:"3" validate:"min=0,max=10"`
+	} `mapstructure:"retry"`
+}
+
+func TestBindingDecode(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings map[string]interface{}
+		listen   string
+		timeout  time.Duration
+		times    int
+		ok       bool
+	}{
+		{"defaults", nil, ":8080", 10 * time.Second, 3, true},
+		{"set", map[string]interface{}{"listen": ":80", "timeout": "1m", "retry": map[string]interface{}{"times": 5}}, ":80", time.Minute, 5, true},
+		{"partial", map[string]interface{}{"retry": map[string]interface{}{}}, ":8080", 10 * time.Second, 3, true},
+		{"required", map[string]interface{}{"listen": ""}, "", 0, 0, false},
+		{"min", map[string]interface{}{"timeout": "0s"}, "", 0, 0, false},
+		{"max", map[string]interface{}{"retry": map[string]interface{}{"times": 11}}, "", 0, 0, false},
+		{"oneof", map[string]interface{}{"mode": "slow"}, "", 0, 0, false},
+		{"max length", map[string]interface{}{"tags": []string{"a", "b", "c"}}, "", 0, 0, false},
+		{"bad type", map[string]interface{}{"timeout": "soon"}, "", 0, 0, false},
+	}
+	for _, c := range cases {
+		v := viper.New()
+		if c.settings != nil {
+			v.Set("test.binding", c.settings)
+		}
+		b := &Binding[testBindingConfig]{key: "test.binding"}
+		value, err := b.decode(v)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: decode() = %v, want ok %v", c.name, err, c.ok)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if value.Listen != c.listen || value.Timeout != c.timeout || value.Retry.Times != c.times {
+			t.Errorf("%s: decode() = %+v, want %v, %v, %v", c.name, value, c.listen, c.timeout, c.times)
+		}
+	}
+}
+
+func TestBindingReload(t *testing.T) {
+	testInit(t)
+
+	b, err := BindConfig[testBindingConfig]("test.binding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Cancel()
+
+	changes := make(chan string, 1)
+	b.OnChange(func(old, new testBindingConfig) {
+		// Binding is usable in functions
+		b.OnChange(func(old, new testBindingConfig) {})
+		changes <- old.Listen + " " + new.Listen + " " + b.Get().Listen
+	})
+
+	cases := []struct {
+		name   string
+		config string
+		listen string
+		change string
+		ok     bool
+	}{
+		{"changed", "test: {binding: {listen: ':80'}}", ":80", ":8080 :80 :80", true},
+		{"unchanged", "test: {binding: {listen: ':80'}}", ":80", "", true},
+		{"rejected", "test: {binding: {listen: ':81', mode: slow}}", ":80", "", false},
+	}
+	for _, c := range cases {
+		ProviderRegister(testProvider(c.config), "test/binding")
+		done := make(chan error, 1)
+		go func() { done <- Reload() }()
+		select {
+		case err := <-done:
+			if (err == nil) != c.ok {
+				t.Errorf("%s: Reload() = %v, want ok %v", c.name, err, c.ok)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: Reload blocked by change function", c.name)
+		}
+		if listen := b.Get().Listen; listen != c.listen {
+			t.Errorf("%s: Listen = %q, want %q", c.name, listen, c.listen)
+		}
+		select {
+		case change := <-changes:
+			if change != c.change {
+				t.Errorf("%s: change = %q, want %q", c.name, change, c.change)
+			}
+		default:
+			if c.change != "" {
+				t.Errorf("%s: change function is not executed", c.name)
+			}
+		}
+	}
+
+	ProviderCancel("test/binding")
+	Reload()
+}
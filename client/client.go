@@ -26,6 +26,13 @@ var (
 	ErrConfigure = fmt.Errorf("client: unexcept configure")
 )
 
+func init() {
+	base.DefaultRegister("http_client.<name>.host", "", "URL of host, its path is the default path of requests")
+	base.DefaultRegister("http_client.<name>.timeout", "", "Timeout of requests, e.g. 10s")
+	base.DefaultRegister("http_client.<name>.header", map[string]interface{}{}, "Header of requests")
+	base.DefaultRegister("http_client.<name>.query", map[string]interface{}{}, "Query of requests")
+}
+
 // Context of client
 type Context struct {
 	*base.TaskBase
@@ -57,7 +64,9 @@ func NewContext(name string) *Context {
 
 	c := &Context{name: name}
 	clientMap.Store(name, c)
-	base.NewTaskOnReload(c, fmt.Sprintf("client/%s", name))
+	if task, err := base.NewTaskOnReload(c, fmt.Sprintf("client/%s", name)); err == nil {
+		task.Subscribe(fmt.Sprintf("http_client.%s", name))
+	}
 
 	return c
 }
@@ -141,6 +150,16 @@ func (c *Context) Schedule(ctx context.Context) error {
 	return nil
 }
 
+// Path return the default path of request
+func (c *Context) Path() string {
+	return c.path
+}
+
+// Header return a copy of the default header of request
+func (c *Context) Header() http.Header {
+	return c.header.Clone()
+}
+
 // R return a *resty.Request
 func (c *Context) R() *resty.Request {
 	request := c.client.R()
@@ -0,0 +1,769 @@
+package base
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// confer is used for initialize config
+//
+// Config file is parsed into a staging viper and checked by validators first,
+// it will take effect only if all validators passed.
+//
+// Files are merged by order, maps are merged deeply:
+//
+//	<name>.yaml           main config file
+//	<name>.d/*.yaml       by lexical order
+//	<name>.<env>.yaml     env is selected by environment variable <PREFIX>_ENV
+//	<name>.override.yaml  written by ConfigOverride
+//	providers             registered by ProviderRegister
+type confer struct {
+	*TaskBase
+
+	// config file in use, empty if no config file
+	file string
+	// files loaded at last time, and source of each key
+	files   []string
+	sources map[string]string
+	// keys changed at last time
+	changed []string
+	// content of files loaded at last time, to skip events of unchanged files
+	contents   map[string][]byte
+	contentMtx sync.Mutex
+
+	// options set by Init
+	given    string
+	search   bool
+	optional bool
+	watch    bool
+	watchers map[string]*Task
+
+	env       bool
+	envPrefix string
+
+	read bool
+	mtx  sync.Mutex
+}
+
+func (c *confer) Reload(ctx context.Context) error {
+	return nil
+}
+
+func (c *confer) Retire(ctx context.Context) error {
+	return nil
+}
+
+func (c *confer) Schedule(ctx context.Context) error {
+	c.mtx.Lock()
+	event, err := c.schedule()
+	c.mtx.Unlock()
+
+	// Emitted after unlocking, so that handlers could get sources of config
+	if event != nil {
+		eventEmit(*event)
+	}
+	return err
+}
+
+// schedule read and load config, return event of config changed if any, mtx
+// must be held
+func (c *confer) schedule() (*Event, error) {
+	if c.read == false {
+		if err := c.init(); err != nil {
+			return nil, err
+		}
+	}
+	return c.load()
+}
+
+// setup set options of confer, they take effect at next schedule
+func (c *confer) setup(options Options) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.given = options.ConfigFile
+	c.search = options.NoConfigSearch == false
+	c.optional = options.ConfigRequired == false
+	c.watch = options.NoConfigWatch == false
+	c.env = options.NoEnv == false
+	c.envPrefix = options.EnvPrefix
+	if c.envPrefix == "" {
+		c.envPrefix = GetAppName()
+	}
+	if flag := flagSet.Lookup("config"); flag != nil && flag.Changed == true {
+		c.given = flag.Value.String()
+	}
+	c.read = false
+}
+
+func (c *confer) init() error {
+	file := c.given
+	if file == "" && c.search == true {
+		var err error
+		if file, err = c.lookup(); err != nil && c.optional == false {
+			return err
+		}
+	} else if file == "" && c.optional == false {
+		return fmt.Errorf("No config file specified")
+	}
+
+	// Stop watching previous file
+	if c.watch == false || c.file != file {
+		for dir, watcher := range c.watchers {
+			watcher.Stop()
+			delete(c.watchers, dir)
+		}
+	}
+
+	c.file = file
+	c.read = true
+	if c.file == "" {
+		c.Log.Debug("No config file, run with defaults")
+		return nil
+	}
+	viper.SetConfigFile(c.file)
+	return nil
+}
+
+// name return name of config file without extension
+func (c *confer) name() string {
+	return strings.TrimSuffix(filepath.Base(c.file), filepath.Ext(c.file))
+}
+
+// overlays return files to merge over main config file by order
+func (c *confer) overlays() (files []string) {
+	dir, name := filepath.Dir(c.file), c.name()
+
+	// <name>.d/*
+	confd := filepath.Join(dir, name+".d")
+	if entries, err := ioutil.ReadDir(confd); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() == false && confSupported(entry.Name()) == true {
+				files = append(files, filepath.Join(confd, entry.Name()))
+			}
+		}
+	}
+
+	// <name>.<env>.*
+	if env := os.Getenv(envName(c.envPrefix) + "_ENV"); env != "" && env != "override" {
+		if file, err := c.find(fmt.Sprintf("%s.%s", name, env), []string{dir}); err == nil {
+			files = append(files, file)
+		}
+	}
+
+	// <name>.override.*
+	if file, err := c.find(name+".override", []string{dir}); err == nil {
+		files = append(files, file)
+	}
+	return files
+}
+
+// unchanged return whether content of file equals to the one loaded
+func (c *confer) unchanged(file string) bool {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	c.contentMtx.Lock()
+	defer c.contentMtx.Unlock()
+	loaded, ok := c.contents[file]
+	return ok == true && bytes.Equal(loaded, buf) == true
+}
+
+// watchTrigger watch directories of config files
+func (c *confer) watchTrigger() {
+	if c.watch == false || c.file == "" {
+		return
+	}
+	if c.watchers == nil {
+		c.watchers = map[string]*Task{}
+	}
+
+	dir, name := filepath.Dir(c.file), c.name()
+	for _, d := range []string{dir, filepath.Join(dir, name+".d")} {
+		if _, ok := c.watchers[d]; ok == true {
+			continue
+		}
+		if fi, err := os.Stat(d); err != nil || fi.IsDir() == false {
+			continue
+		}
+		watcher := &conferWatcher{dir: dir, name: name}
+		if task, err := NewTaskOnFsChange(watcher, d, "config/watcher"); err == nil {
+			c.watchers[d] = task
+		}
+	}
+}
+
+// lookup search config file in directory tree of app
+func (c *confer) lookup() (string, error) {
+	name := GetExecName()
+	if strings.HasSuffix(name, "test") {
+		name = "test"
+	}
+
+	// Seach directory tree
+	var paths []string
+	for _, base := range []string{GetExecDir(), GetWorkDir()} {
+		for ; ; base = path.Dir(base) {
+			paths = append(paths,
+				base,
+				filepath.Join(base, "etc"),
+				filepath.Join(base, "conf"),
+				filepath.Join(base, "config"),
+				filepath.Join(base, "configs"),
+			)
+			if base == path.Dir(base) {
+				break
+			}
+		}
+	}
+
+	return c.find(name, paths)
+}
+
+// find return the first config file named by name in paths
+func (c *confer) find(name string, paths []string) (string, error) {
+	for _, dir := range paths {
+		for _, ext := range viper.SupportedExts {
+			file := filepath.Join(dir, fmt.Sprintf("%s.%s", name, ext))
+			if fi, err := os.Stat(file); err == nil && fi.IsDir() == false {
+				return file, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("Config file %s.* not found in %v", name, paths)
+}
+
+// layer is a source of config, layers are merged by order
+type layer struct {
+	// name of source, file path or "env", "flag"
+	name string
+
+	// data is parsed by typ, or settings is merged directly
+	typ      string
+	data     []byte
+	settings map[string]interface{}
+}
+
+// apply merge layers into v by order, config of v is replaced
+//
+// The first layer is read to replace config at once, so that readers won't
+// see an empty config while merging
+func (c *confer) apply(v *viper.Viper, layers []layer) (err error) {
+	defer v.SetConfigType("")
+
+	for i, l := range layers {
+		if l.data != nil {
+			v.SetConfigType(l.typ)
+			if i == 0 {
+				err = v.ReadConfig(bytes.NewReader(l.data))
+			} else {
+				err = v.MergeConfig(bytes.NewReader(l.data))
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to parse config %v: %v", l.name, err)
+			}
+		} else if i == 0 {
+			v.SetConfigType("json")
+			if err = v.ReadConfig(strings.NewReader("{}")); err != nil {
+				return err
+			}
+		}
+		if l.settings != nil {
+			if err = v.MergeConfigMap(l.settings); err != nil {
+				return fmt.Errorf("Failed to merge config %v: %v", l.name, err)
+			}
+		}
+	}
+	if len(layers) == 0 {
+		v.SetConfigType("json")
+		return v.ReadConfig(strings.NewReader("{}"))
+	}
+	return nil
+}
+
+// load parse config into staging, and commit it if validators passed, return
+// event of config changed if any keys changed
+//
+// Precedence order: flags > env > files > defaults
+func (c *confer) load() (*Event, error) {
+	contents, layers, values, err := c.stage(nil)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, l := range layers {
+		if _, ok := contents[l.name]; ok == true {
+			files = append(files, l.name)
+		}
+	}
+
+	// Layers have been applied to staging, so global viper won't fail here
+	secretStore(values)
+	defaultApply(viper.GetViper())
+	old := viper.AllSettings()
+	if err := c.apply(viper.GetViper(), layers); err != nil {
+		return nil, err
+	}
+	settings := viper.AllSettings()
+	loaded := c.sources != nil
+	c.files, c.sources = files, c.source(layers)
+	c.changed = configDiff(old, settings)
+	c.contentMtx.Lock()
+	c.contents = contents
+	c.contentMtx.Unlock()
+	if len(c.changed) == 0 {
+		return nil, nil
+	}
+	if log := c.Log.WithFields(map[string]interface{}{"keys": c.changed}); loaded == false {
+		log.Debug("Config loaded")
+	} else {
+		log.Info("Config changed")
+	}
+	return &Event{
+		Type: EventConfigChanged,
+		Old:  secretRedactValue(old),
+		New:  secretRedactValue(settings),
+		Keys: append([]string{}, c.changed...),
+	}, nil
+}
+
+// stage parse all layers into a staging viper and run validators on it
+//
+// Content of files in pending is used instead of reading from disk, so that a
+// config could be checked before it is saved.
+func (c *confer) stage(pending map[string][]byte) (map[string][]byte, []layer, []string, error) {
+	var files []string
+	var layers []layer
+	if c.file != "" {
+		c.watchTrigger()
+		files = append([]string{c.file}, c.overlays()...)
+	}
+	for file := range pending {
+		// Override file may not exist yet, it is the last one
+		found := false
+		for _, f := range files {
+			found = found || f == file
+		}
+		if found == false {
+			files = append(files, file)
+		}
+	}
+	contents := map[string][]byte{}
+	for _, file := range files {
+		buf, ok := pending[file]
+		if ok == false {
+			var err error
+			if buf, err = ioutil.ReadFile(file); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		contents[file] = buf
+		layers = append(layers, layer{
+			name: file,
+			typ:  strings.TrimPrefix(filepath.Ext(file), "."),
+			data: buf,
+		})
+	}
+
+	// Providers are merged over files, by order of key
+	var keys []string
+	providers := map[string]ConfigProvider{}
+	providerMap.Range(func(key, value interface{}) bool {
+		keys = append(keys, key.(string))
+		providers[key.(string)] = value.(ConfigProvider)
+		return true
+	})
+	sort.Strings(keys)
+	for _, key := range keys {
+		buf, typ, err := providers[key].Config()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Failed to get config from provider %v: %v", key, err)
+		}
+		if buf != nil {
+			layers = append(layers, layer{name: key, typ: typ, data: buf})
+		}
+	}
+
+	staging := viper.New()
+	defaultApply(staging)
+	if err := c.apply(staging, layers); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Overrides are mapped to keys known by files
+	keys = staging.AllKeys()
+	if c.env == true {
+		layers = append(layers, layer{name: "env", settings: envSettings(c.envPrefix, keys)})
+	}
+	layers = append(layers, layer{name: "flag", settings: flagSettings()})
+	if err := c.apply(staging, layers); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Secret references are resolved at last
+	secrets, values, err := secretResolve(staging.AllSettings())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if 0 < len(secrets) {
+		layers = append(layers, layer{name: "secret", settings: secrets})
+		if err := c.apply(staging, layers); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if err := c.validate(staging); err != nil {
+		return nil, nil, nil, err
+	}
+	return contents, layers, values, nil
+}
+
+// Changed return keys changed at last load
+func (c *confer) Changed() []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]string{}, c.changed...)
+}
+
+// configDiff return sorted keys whose values differ between settings
+func configDiff(old, new map[string]interface{}) []string {
+	var flatten func(values map[string]interface{}, settings map[string]interface{}, prefix string)
+	flatten = func(values map[string]interface{}, settings map[string]interface{}, prefix string) {
+		for key, value := range settings {
+			if m, ok := value.(map[string]interface{}); ok == true && 0 < len(m) {
+				flatten(values, m, prefix+key+".")
+			} else {
+				values[prefix+key] = value
+			}
+		}
+	}
+	o, n := map[string]interface{}{}, map[string]interface{}{}
+	flatten(o, old, "")
+	flatten(n, new, "")
+
+	var keys []string
+	for key, value := range o {
+		if v, ok := n[key]; ok == false || reflect.DeepEqual(value, v) == false {
+			keys = append(keys, key)
+		}
+	}
+	for key := range n {
+		if _, ok := o[key]; ok == false {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configMatch return whether any key matches any prefix
+func configMatch(keys []string, prefixes []string) bool {
+	for _, key := range keys {
+		for _, prefix := range prefixes {
+			prefix = strings.TrimSuffix(strings.ToLower(prefix), ".")
+			if key == prefix || strings.HasPrefix(key, prefix+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// source return name of layer where each key come from, the last one wins
+func (c *confer) source(layers []layer) map[string]string {
+	sources := map[string]string{}
+	for _, l := range layers {
+		// Keep where the reference of secret come from
+		if l.name == "secret" {
+			continue
+		}
+		v := viper.New()
+		if err := c.apply(v, []layer{l}); err != nil {
+			continue
+		}
+		for _, key := range v.AllKeys() {
+			sources[key] = l.name
+		}
+	}
+	return sources
+}
+
+// validate run all functions in validateFuncs on staging viper
+func (c *confer) validate(staging *viper.Viper) (err error) {
+	validateFuncs.Range(func(key, value interface{}) bool {
+		if e := value.(func(*viper.Viper) error)(staging); e != nil {
+			err = fmt.Errorf("Config was rejected by validator %v: %v", key, e)
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// ConfigProvider provide config to be merged over config files
+type ConfigProvider interface {
+	// Config return content of config and its type, such as yaml or json,
+	// nothing is merged if content is nil. It is called on every reload,
+	// so content should be fetched and cached by provider itself.
+	Config() (content []byte, typ string, err error)
+}
+
+// providerMap holds config providers by key
+var providerMap sync.Map
+
+// ProviderRegister is used to register a config provider, it takes effect at next reload
+//
+// Providers are merged over config files by order of key, and under
+// environment variables and flags
+func ProviderRegister(provider ConfigProvider, key string) {
+	providerMap.Store(key, provider)
+}
+
+// ProviderCancel is used to cancel a config provider
+func ProviderCancel(key string) {
+	providerMap.Delete(key)
+}
+
+// ConfigSet is used to set values of keys and save them into config file
+//
+// Keys are separated by `.`, key with nil value is removed. New config is
+// checked by validators before saving, and takes effect at once. The file is
+// replaced atomically in its format and permission, comments are lost.
+func ConfigSet(values map[string]interface{}) error {
+	return configSave(values, false)
+}
+
+// ConfigOverride is same as ConfigSet, but values are saved into override
+// file `<name>.override.<ext>` beside config file, which is merged over all
+// other config files, so that the main config file is kept untouched
+func ConfigOverride(values map[string]interface{}) error {
+	return configSave(values, true)
+}
+
+// configSave save values into config file and reload
+func configSave(values map[string]interface{}, override bool) error {
+	initTrigger()
+	if err := conferInstance.save(values, override); err != nil {
+		return err
+	}
+	return Reload()
+}
+
+// save set values into config or override file, if new config passed validators
+func (c *confer) save(values map[string]interface{}, override bool) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.read == false {
+		if err := c.init(); err != nil {
+			return err
+		}
+	}
+	if c.file == "" {
+		return fmt.Errorf("No config file to save")
+	}
+
+	file := c.file
+	if override == true {
+		var err error
+		if file, err = c.find(c.name()+".override", []string{filepath.Dir(c.file)}); err != nil {
+			file = filepath.Join(filepath.Dir(c.file), c.name()+".override"+filepath.Ext(c.file))
+		}
+	}
+	typ := strings.TrimPrefix(filepath.Ext(file), ".")
+
+	// Values are set into what is in the file only
+	settings := map[string]interface{}{}
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(c.file); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if buf, err := ioutil.ReadFile(file); err == nil {
+		v := viper.New()
+		v.SetConfigType(typ)
+		if err := v.ReadConfig(bytes.NewReader(buf)); err != nil {
+			return fmt.Errorf("Failed to parse config %v: %v", file, err)
+		}
+		settings = v.AllSettings()
+		if fi, err := os.Stat(file); err == nil {
+			mode = fi.Mode().Perm()
+		}
+	} else if os.IsNotExist(err) == false {
+		return err
+	}
+	for key, value := range values {
+		if value == nil {
+			settingsDelete(settings, key)
+		} else {
+			settingsSet(settings, key, value)
+		}
+	}
+
+	v := viper.New()
+	v.SetConfigType(typ)
+	if err := v.MergeConfigMap(settings); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := v.WriteConfigTo(&buf); err != nil {
+		return fmt.Errorf("Failed to encode config %v: %v", file, err)
+	}
+
+	if _, _, _, err := c.stage(map[string][]byte{file: buf.Bytes()}); err != nil {
+		return err
+	}
+
+	// Content is recorded before writing, so that watcher skips the event
+	// and only the following Reload loads it
+	c.contentMtx.Lock()
+	previous, ok := c.contents[file]
+	if c.contents == nil {
+		c.contents = map[string][]byte{}
+	}
+	c.contents[file] = buf.Bytes()
+	c.contentMtx.Unlock()
+	if err := writeFileAtomic(file, buf.Bytes(), mode); err != nil {
+		c.contentMtx.Lock()
+		if ok == true {
+			c.contents[file] = previous
+		} else {
+			delete(c.contents, file)
+		}
+		c.contentMtx.Unlock()
+		return err
+	}
+	c.Log.WithFields(map[string]interface{}{"file": file, "keys": len(values)}).Info("Config saved")
+	return nil
+}
+
+// writeFileAtomic write data into a temporary file and rename it to file
+func writeFileAtomic(file string, data []byte, mode os.FileMode) error {
+	// Hidden temporary file is ignored by watchers
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// confSupported return whether file is a supported config file by extension
+func confSupported(file string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(file), ".")
+	for _, supported := range viper.SupportedExts {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// GetConfigFiles return config files loaded, by merged order
+func GetConfigFiles() []string {
+	initTrigger()
+	conferInstance.mtx.Lock()
+	defer conferInstance.mtx.Unlock()
+	return append([]string{}, conferInstance.files...)
+}
+
+// GetConfigSource return where the effective value of key come from,
+// a file path, "env", "flag" or "default", empty if key is not set
+func GetConfigSource(key string) string {
+	initTrigger()
+	conferInstance.mtx.Lock()
+	defer conferInstance.mtx.Unlock()
+	if source, ok := conferInstance.sources[strings.ToLower(key)]; ok == true {
+		return source
+	}
+	if defaultHas(key) == true {
+		return "default"
+	}
+	return ""
+}
+
+// GetConfigSources return sources of all keys, see GetConfigSource
+func GetConfigSources() map[string]string {
+	initTrigger()
+	conferInstance.mtx.Lock()
+	defer conferInstance.mtx.Unlock()
+	sources := make(map[string]string, len(conferInstance.sources))
+	for key, source := range conferInstance.sources {
+		sources[key] = source
+	}
+	return sources
+}
+
+// conferWatcher is used to reload when config files changed
+type conferWatcher struct {
+	*TaskBase
+
+	// directory and name of main config file
+	dir  string
+	name string
+}
+
+func (c *conferWatcher) Reload(ctx context.Context) error {
+	return nil
+}
+
+func (c *conferWatcher) Retire(ctx context.Context) error {
+	return nil
+}
+
+func (c *conferWatcher) Schedule(ctx context.Context) error {
+	event, ok := c.Argument.(fsnotify.Event)
+	if ok == false || confSupported(event.Name) == false {
+		return nil
+	}
+	dir, file := filepath.Split(filepath.Clean(event.Name))
+	switch filepath.Clean(dir) {
+	case c.dir:
+		// <name>.* and <name>.<env>.*
+		if strings.HasPrefix(file, c.name+".") == false {
+			return nil
+		}
+	case filepath.Join(c.dir, c.name+".d"):
+	default:
+		return nil
+	}
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return nil
+	}
+	// Saved by ConfigSet or written again with the same content
+	if conferInstance.unchanged(filepath.Clean(event.Name)) == true {
+		return nil
+	}
+
+	c.Log.WithFields(map[string]interface{}{"event": event}).
+		Debug("Config file has changed, auto reload")
+	Reload()
+	return nil
+}
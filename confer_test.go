@@ -0,0 +1,266 @@
+package base
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// testConfer return a confer of given file
+func testConfer(file string) *confer {
+	return &confer{
+		TaskBase:  &TaskBase{Log: logrus.NewEntry(logrus.StandardLogger())},
+		given:     file,
+		envPrefix: "BASETEST",
+	}
+}
+
+// testWrite write files under dir with contents
+func testWrite(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConferLoad(t *testing.T) {
+	ValidateRegister(func(v *viper.Viper) error {
+		if v.GetInt("test.load.port") < 0 {
+			return fmt.Errorf("Port must not be negative")
+		}
+		return nil
+	}, "test/load")
+	defer ValidateCancel("test/load")
+	defer Reload()
+
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	cases := []struct {
+		name    string
+		content string
+		port    int
+		ok      bool
+	}{
+		{"valid", "test: {load: {port: 80}}", 80, true},
+		{"changed", "test: {load: {port: 81}}", 81, true},
+		{"rejected", "test: {load: {port: -1}}", 81, false},
+		{"bad yaml", "test: [", 81, false},
+	}
+	for _, c := range cases {
+		if err := os.WriteFile(file, []byte(c.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		conf := testConfer(file)
+		if err := conf.init(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conf.load(); (err == nil) != c.ok {
+			t.Errorf("%s: load() = %v, want ok %v", c.name, err, c.ok)
+		}
+		if port := viper.GetInt("test.load.port"); port != c.port {
+			t.Errorf("%s: port = %d, want %d", c.name, port, c.port)
+		}
+	}
+}
+
+func TestConferOverlays(t *testing.T) {
+	t.Setenv("BASETEST_ENV", "prod")
+	defer Reload()
+
+	dir := t.TempDir()
+	testWrite(t, dir, map[string]string{
+		"app.yaml":          "test: {a: main, b: main, c: main, d: main, e: main}",
+		"app.d/20-b.yaml":   "test: {b: b20, c: b20}",
+		"app.d/10-a.yaml":   "test: {b: a10}",
+		"app.d/ignored.txt": "test: {d: ignored}",
+		"app.prod.yaml":     "test: {c: prod}",
+		"app.dev.yaml":      "test: {c: dev}",
+		"app.override.yaml": "test: {e: override}",
+	})
+	file := filepath.Join(dir, "app.yaml")
+	c := testConfer(file)
+	if err := c.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{
+		filepath.Join(dir, "app.d", "10-a.yaml"),
+		filepath.Join(dir, "app.d", "20-b.yaml"),
+		filepath.Join(dir, "app.prod.yaml"),
+		filepath.Join(dir, "app.override.yaml"),
+	}
+	if overlays := c.overlays(); fmt.Sprint(overlays) != fmt.Sprint(files) {
+		t.Errorf("overlays() = %v, want %v", overlays, files)
+	}
+
+	if _, err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		key, value, source string
+	}{
+		{"test.a", "main", file},
+		{"test.b", "b20", files[1]},
+		{"test.c", "prod", files[2]},
+		{"test.d", "main", file},
+		{"test.e", "override", files[3]},
+	}
+	for _, x := range cases {
+		if value := viper.GetString(x.key); value != x.value {
+			t.Errorf("%s = %q, want %q", x.key, value, x.value)
+		}
+		if source := c.sources[x.key]; source != x.source {
+			t.Errorf("source of %s = %q, want %q", x.key, source, x.source)
+		}
+	}
+}
+
+func TestGetConfigSource(t *testing.T) {
+	files := GetConfigFiles()
+	if len(files) == 0 {
+		t.Fatal("No config file is loaded")
+	}
+
+	cases := []struct {
+		key, source string
+	}{
+		{"log.level", files[0]},
+		{"LOG.LEVEL", files[0]},
+		{"test.source.unknown", ""},
+	}
+	for _, c := range cases {
+		if source := GetConfigSource(c.key); source != c.source {
+			t.Errorf("GetConfigSource(%q) = %q, want %q", c.key, source, c.source)
+		}
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	type m = map[string]interface{}
+	cases := []struct {
+		old, new m
+		keys     []string
+	}{
+		{m{}, m{}, nil},
+		{m{"a": 1}, m{"a": 1}, nil},
+		{m{"a": 1}, m{"a": 2}, []string{"a"}},
+		{m{"a": 1}, m{"b": 1}, []string{"a", "b"}},
+		{m{"a": m{"b": 1, "c": 1}}, m{"a": m{"b": 1, "c": 2}}, []string{"a.c"}},
+		{m{"a": m{"b": 1}}, m{"a": 1}, []string{"a", "a.b"}},
+		{m{"a": m{}}, m{"a": m{"b": 1}}, []string{"a", "a.b"}},
+		{m{"a": []string{"x"}}, m{"a": []string{"x", "y"}}, []string{"a"}},
+	}
+	for _, c := range cases {
+		if keys := configDiff(c.old, c.new); fmt.Sprint(keys) != fmt.Sprint(c.keys) {
+			t.Errorf("configDiff(%v, %v) = %v, want %v", c.old, c.new, keys, c.keys)
+		}
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	cases := []struct {
+		keys, prefixes []string
+		ok             bool
+	}{
+		{[]string{"log.level"}, []string{"log"}, true},
+		{[]string{"log.level"}, []string{"log."}, true},
+		{[]string{"log.level"}, []string{"LOG.Level"}, true},
+		{[]string{"log.level"}, []string{"log.lev"}, false},
+		{[]string{"logger.level"}, []string{"log"}, false},
+		{[]string{"log"}, []string{"log.level"}, false},
+		{[]string{"a", "log.file.dir"}, []string{"b", "log.file"}, true},
+		{nil, []string{"log"}, false},
+		{[]string{"log"}, nil, false},
+	}
+	for _, c := range cases {
+		if ok := configMatch(c.keys, c.prefixes); ok != c.ok {
+			t.Errorf("configMatch(%v, %v) = %v, want %v", c.keys, c.prefixes, ok, c.ok)
+		}
+	}
+}
+
+func TestConferSave(t *testing.T) {
+	t.Setenv("BASETEST_TOKEN", "hunter2")
+	ValidateRegister(func(v *viper.Viper) error {
+		if v.GetInt("test.save.port") < 0 {
+			return fmt.Errorf("Port must not be negative")
+		}
+		return nil
+	}, "test/save")
+	defer ValidateCancel("test/save")
+
+	cases := []struct {
+		name     string
+		values   map[string]interface{}
+		override bool
+		file     string
+		want     []string
+		absent   []string
+		ok       bool
+	}{
+		{"set", map[string]interface{}{"test.save.port": 81}, false, "app.yaml",
+			[]string{"port: 81", "${env:BASETEST_TOKEN}", "keep: true"}, []string{"hunter2"}, true},
+		{"delete", map[string]interface{}{"test.save.keep": nil}, false, "app.yaml",
+			[]string{"port: 80"}, []string{"keep"}, true},
+		{"override", map[string]interface{}{"test.save.port": 82}, true, "app.override.yaml",
+			[]string{"port: 82"}, []string{"keep", "token"}, true},
+		{"rejected", map[string]interface{}{"test.save.port": -1}, false, "app.yaml",
+			[]string{"port: 80"}, []string{"-1"}, false},
+	}
+	for _, c := range cases {
+		dir := t.TempDir()
+		main := "test:\n  save:\n    port: 80\n    keep: true\n    token: ${env:BASETEST_TOKEN}\n"
+		testWrite(t, dir, map[string]string{"app.yaml": main})
+		if err := os.Chmod(filepath.Join(dir, "app.yaml"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		err := testConfer(filepath.Join(dir, "app.yaml")).save(c.values, c.override)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: save() = %v, want ok %v", c.name, err, c.ok)
+		}
+
+		buf, err := os.ReadFile(filepath.Join(dir, c.file))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		for _, s := range c.want {
+			if strings.Contains(string(buf), s) == false {
+				t.Errorf("%s: %s has no %q:\n%s", c.name, c.file, s, buf)
+			}
+		}
+		for _, s := range c.absent {
+			if strings.Contains(string(buf), s) == true {
+				t.Errorf("%s: %s has %q:\n%s", c.name, c.file, s, buf)
+			}
+		}
+
+		// Mode of main file is kept, no temporary file is left
+		if fi, err := os.Stat(filepath.Join(dir, c.file)); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if fi.Mode().Perm() != 0600 {
+			t.Errorf("%s: mode of %s = %v, want 0600", c.name, c.file, fi.Mode().Perm())
+		}
+		if c.override == true {
+			if buf, _ := os.ReadFile(filepath.Join(dir, "app.yaml")); string(buf) != main {
+				t.Errorf("%s: main config file is changed:\n%s", c.name, buf)
+			}
+		}
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") == true {
+				t.Errorf("%s: temporary file %s is left", c.name, entry.Name())
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+// defaultEntry is a registered default of config key
+type defaultEntry struct {
+	value       interface{}
+	description string
+}
+
+var (
+	// Defaults of config by key
+	defaultMap sync.Map
+)
+
+// DefaultRegister is used to register default value and description of config key
+//
+// Key with a placeholder in angle brackets, e.g. `websvr.<name>.listen`, is
+// documented in sample config only. Defaults take the lowest precedence.
+func DefaultRegister(key string, value interface{}, description string) {
+	key = strings.ToLower(key)
+	defaultMap.Store(key, &defaultEntry{value: value, description: description})
+
+	// Defaults are applied to global viper by Init
+	if atomic.LoadInt32(&initState) != initNone && defaultTemplate(key) == false {
+		viper.SetDefault(key, value)
+	}
+}
+
+// defaultTemplate return whether key is a template with placeholder
+func defaultTemplate(key string) bool {
+	return strings.Contains(key, "<")
+}
+
+// defaultApply set registered defaults into v
+func defaultApply(v *viper.Viper) {
+	defaultMap.Range(func(key, value interface{}) bool {
+		if defaultTemplate(key.(string)) == false {
+			v.SetDefault(key.(string), value.(*defaultEntry).value)
+		}
+		return true
+	})
+}
+
+// defaultHas return whether key is registered with default
+func defaultHas(key string) bool {
+	_, ok := defaultMap.Load(strings.ToLower(key))
+	return ok
+}
+
+// ConfigSample return a sample config in YAML, commented by descriptions of defaults
+func ConfigSample() string {
+	// Tree of keys
+	type node struct {
+		entry    *defaultEntry
+		children map[string]*node
+	}
+	root := &node{children: map[string]*node{}}
+	defaultMap.Range(func(key, value interface{}) bool {
+		n := root
+		for _, segment := range strings.Split(key.(string), ".") {
+			if n.children == nil {
+				n.children = map[string]*node{}
+			}
+			if n.children[segment] == nil {
+				n.children[segment] = &node{}
+			}
+			n = n.children[segment]
+		}
+		n.entry = value.(*defaultEntry)
+		return true
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Sample config of %s\n", GetAppName())
+
+	var write func(n *node, indent string)
+	write = func(n *node, indent string) {
+		var keys []string
+		for key := range n.children {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := n.children[key]
+			if indent == "" {
+				buf.WriteString("\n")
+			}
+			if child.entry != nil && child.entry.description != "" {
+				for _, line := range strings.Split(child.entry.description, "\n") {
+					fmt.Fprintf(&buf, "%s# %s\n", indent, line)
+				}
+			}
+			if 0 < len(child.children) {
+				fmt.Fprintf(&buf, "%s%s:\n", indent, key)
+				write(child, indent+"  ")
+				continue
+			}
+
+			value, err := json.Marshal(child.entry.value)
+			if err != nil || child.entry.value == nil {
+				fmt.Fprintf(&buf, "%s%s:\n", indent, key)
+			} else {
+				fmt.Fprintf(&buf, "%s%s: %s\n", indent, key, value)
+			}
+		}
+	}
+	write(root, "")
+
+	return buf.String()
+}
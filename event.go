@@ -0,0 +1,145 @@
+package base
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EventType indicates type of lifecycle event, could be combined as a mask
+type EventType uint
+
+const (
+	// EventAppStarted fires once after initialization
+	EventAppStarted EventType = 1 << iota
+	// EventConfigChanged fires when new config took effect, Old and New are
+	// settings with secrets masked, Keys are changed keys
+	EventConfigChanged
+	// EventReloadBegin fires before reload
+	EventReloadBegin
+	// EventReloadEnd fires after reload, Err is set if reload failed
+	EventReloadEnd
+	// EventRetireBegin fires before retire, Code is exit code
+	EventRetireBegin
+	// EventRetireEnd fires after retire functions executed, before exit
+	EventRetireEnd
+	// EventDaemonRestart fires before a daemon process is started
+	EventDaemonRestart
+	// EventLiteModeChanged fires when lite mode changed, Old and New are bool
+	EventLiteModeChanged
+	// EventLiverDeath fires when a live context died, Key is the liver key
+	EventLiverDeath
+
+	// EventAll matches all types of event
+	EventAll EventType = 1<<iota - 1
+)
+
+var eventNames = map[EventType]string{
+	EventAppStarted:      "app_started",
+	EventConfigChanged:   "config_changed",
+	EventReloadBegin:     "reload_begin",
+	EventReloadEnd:       "reload_end",
+	EventRetireBegin:     "retire_begin",
+	EventRetireEnd:       "retire_end",
+	EventDaemonRestart:   "daemon_restart",
+	EventLiteModeChanged: "lite_mode_changed",
+	EventLiverDeath:      "liver_death",
+}
+
+// String return name of event type
+func (t EventType) String() string {
+	if name, ok := eventNames[t]; ok == true {
+		return name
+	}
+	return "unknown"
+}
+
+// Event of lifecycle
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Old and New values, according to event type
+	Old interface{}
+	New interface{}
+
+	Key  string
+	Keys []string
+	Code int
+	Err  error
+}
+
+// eventHandler is a registered event function
+type eventHandler struct {
+	mask     EventType
+	function func(Event)
+}
+
+var (
+	// Functions to execute when event fire
+	eventFuncs sync.Map
+
+	// Event of app started, replay to functions registered later
+	eventStarted *Event
+	eventMtx     sync.Mutex
+)
+
+// EventRegister is used to register a function to be executed when event fire
+//
+// Function is executed synchronously by emitter, so it must not block or call
+// Reload/Retire. All types of event are matched if no type specified.
+// EventAppStarted will be replayed if app has already started.
+func EventRegister(function func(Event), key string, types ...EventType) {
+	var mask EventType
+	for _, t := range types {
+		mask |= t
+	}
+	if mask == 0 {
+		mask = EventAll
+	}
+	eventFuncs.Store(key, &eventHandler{mask: mask, function: function})
+
+	eventMtx.Lock()
+	started := eventStarted
+	eventMtx.Unlock()
+	if started != nil && mask&EventAppStarted != 0 {
+		eventCall(key, function, *started)
+	}
+}
+
+// EventCancel is used to cancel a function to be executed when event fire
+func EventCancel(key string) {
+	eventFuncs.Delete(key)
+}
+
+// eventEmit execute all functions that match type of event
+func eventEmit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Type == EventAppStarted {
+		eventMtx.Lock()
+		eventStarted = &event
+		eventMtx.Unlock()
+	}
+
+	eventFuncs.Range(func(key, value interface{}) bool {
+		handler := value.(*eventHandler)
+		if handler.mask&event.Type != 0 {
+			eventCall(key, handler.function, event)
+		}
+		return true
+	})
+}
+
+// eventCall execute function and recover from panic
+func eventCall(key interface{}, function func(Event), event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithFields(logrus.Fields{"key": key, "event": event.Type, "panic": r}).
+				Error("Event function panicked")
+		}
+	}()
+	function(event)
+}
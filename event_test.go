@@ -0,0 +1,47 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+// testProvider provide config by content
+type testProvider string
+
+func (p testProvider) Config() ([]byte, string, error) {
+	return []byte(p), "yaml", nil
+}
+
+func TestEventConfigChangedSource(t *testing.T) {
+	testInit(t)
+
+	sources := make(chan string, 1)
+	EventRegister(func(event Event) {
+		select {
+		case sources <- GetConfigSource("test.event"):
+		default:
+		}
+	}, "test/event", EventConfigChanged)
+	defer EventCancel("test/event")
+
+	ProviderRegister(testProvider("test: {event: 1}"), "test/event")
+	defer ProviderCancel("test/event")
+
+	done := make(chan error, 1)
+	go func() { done <- Reload() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		// Config is locked, nothing could be cleaned up
+		t.Fatal("Reload blocked by event handler")
+	}
+	if source := <-sources; source != "test/event" {
+		t.Errorf("source = %q, want test/event", source)
+	}
+
+	ProviderCancel("test/event")
+	Reload()
+}
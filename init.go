@@ -0,0 +1,179 @@
+package base
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+// Options of Init, zero value enables all features
+type Options struct {
+	// NoSignal disable handling SIGTERM, SIGINT, SIGUSR1 and SIGUSR2
+	NoSignal bool
+	// NoMemor disable memory watching, which restarts app when over limit
+	NoMemor bool
+	// NoLogger disable setting up logrus, level, format, output and hooks
+	NoLogger bool
+	// NoVersion disable handling `--version` in command line arguments, which
+	// is parsed by FlagSet only if NoFlags is false
+	NoVersion bool
+
+	// ConfigFile specify the config file, search is skipped if it is set
+	ConfigFile string
+	// NoConfigSearch disable searching config file in directory tree of app
+	NoConfigSearch bool
+	// NoConfigWatch disable reloading when config file changed
+	NoConfigWatch bool
+	// ConfigRequired fail if config file is not found, otherwise run with defaults
+	ConfigRequired bool
+
+	// NoEnv disable overriding config by environment variables
+	NoEnv bool
+	// EnvPrefix is prefix of environment variables, name of app by default
+	EnvPrefix string
+	// NoFlags disable parsing command line arguments by FlagSet
+	NoFlags bool
+}
+
+// libraryOptions is used when Init is triggered lazily by packages built
+// on base, so that the host process won't be taken over
+var libraryOptions = Options{
+	NoSignal:      true,
+	NoMemor:       true,
+	NoLogger:      true,
+	NoVersion:     true,
+	NoConfigWatch: true,
+	NoFlags:       true,
+}
+
+// States of Init
+const (
+	initNone int32 = iota
+	initRunning
+	initDone
+)
+
+var (
+	// initState is one of states of Init, initOwner is goroutine running Init
+	initState int32
+	initOwner int64
+	initMtx   sync.Mutex
+
+	// Event of app started is emitted only once
+	startedOnce sync.Once
+)
+
+// Init initialize base by options, it should be called at the beginning of main
+//
+// If Init is not called, it will be triggered with library options by the
+// first Task, which only loads config file if found. Calling Init again
+// enables features that are not yet enabled and reloads.
+func Init(options Options) error {
+	initMtx.Lock()
+	defer initMtx.Unlock()
+	return initLocked(options)
+}
+
+// initLocked is Init with initMtx held, base is regarded as initialized only
+// after it is done, calls from Init itself pass through initTrigger
+func initLocked(options Options) error {
+	atomic.StoreInt64(&initOwner, initGoroutine())
+	defer atomic.StoreInt64(&initOwner, 0)
+	atomic.CompareAndSwapInt32(&initState, initNone, initRunning)
+
+	inforTrigger()
+
+	if options.NoFlags == false {
+		// Help is left to host, as same as flags unknown
+		if err := flagParse(); err != nil && err != pflag.ErrHelp {
+			return err
+		}
+	}
+
+	// Print sample config and exit if `--config-sample` in arguments
+	if sample, _ := flagSet.GetBool("config-sample"); sample == true {
+		fmt.Print(ConfigSample())
+		os.Exit(0)
+	}
+
+	// Print version and exit if `--version` in arguments
+	if options.NoVersion == false {
+		if format, ok := versionFlag(); ok == true {
+			if err := versionPrint(format); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			os.Exit(0)
+		}
+	}
+
+	if options.NoSignal == false {
+		sigerTrigger()
+	}
+	if options.NoMemor == false {
+		memorTrigger()
+	}
+
+	conferTrigger()
+	conferInstance.setup(options)
+
+	loggerTrigger()
+	if options.NoLogger == false {
+		loggerInstance.enabled = true
+		samplerTrigger()
+	}
+
+	// Initialize by Reload function
+	err := Reload()
+	atomic.StoreInt32(&initState, initDone)
+	if err != nil {
+		return err
+	}
+
+	startedOnce.Do(func() {
+		eventEmit(Event{Type: EventAppStarted})
+	})
+	return nil
+}
+
+// initTrigger call Init with library options if Init has not been called,
+// callers wait until Init is done
+//
+// Error is logged instead of returned, base runs with defaults, so that a
+// package built on base won't crash the host by invalid config.
+func initTrigger() {
+	if atomic.LoadInt32(&initState) == initDone || atomic.LoadInt64(&initOwner) == initGoroutine() {
+		return
+	}
+
+	initMtx.Lock()
+	defer initMtx.Unlock()
+	if atomic.LoadInt32(&initState) == initDone {
+		return
+	}
+	if err := initLocked(libraryOptions); err != nil {
+		logrus.WithError(err).Error("Failed to initialize base, run with defaults")
+	}
+}
+
+// initGoroutine return id of current goroutine
+func initGoroutine() int64 {
+	// Stack begins with "goroutine <id> [<status>]:"
+	buf := make([]byte, 64)
+	fields := bytes.Fields(buf[:runtime.Stack(buf, false)])
+	if len(fields) < 2 {
+		return -1
+	}
+	id, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return id
+}
@@ -0,0 +1,74 @@
+package base
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInitGoroutine(t *testing.T) {
+	id := initGoroutine()
+	if id <= 0 || id != initGoroutine() {
+		t.Fatalf("initGoroutine() = %d, want a stable positive id", id)
+	}
+	other := make(chan int64)
+	go func() { other <- initGoroutine() }()
+	if o := <-other; o <= 0 || o == id {
+		t.Errorf("initGoroutine() of another goroutine = %d, want other than %d", o, id)
+	}
+}
+
+func TestInitTriggerWait(t *testing.T) {
+	testInit(t)
+
+	// Init is running in this goroutine, others wait until it is done
+	initMtx.Lock()
+	atomic.StoreInt32(&initState, initRunning)
+	atomic.StoreInt64(&initOwner, initGoroutine())
+	initTrigger()
+
+	done := make(chan struct{})
+	go func() {
+		initTrigger()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Errorf("initTrigger() returned while Init is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	atomic.StoreInt64(&initOwner, 0)
+	atomic.StoreInt32(&initState, initDone)
+	initMtx.Unlock()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("initTrigger() blocked after Init is done")
+	}
+}
+
+func TestInitReentrant(t *testing.T) {
+	testInit(t)
+
+	// Handlers called by Init may use base
+	EventRegister(func(event Event) {
+		GetConfigFiles()
+	}, "test/init", EventReloadBegin)
+	defer EventCancel("test/init")
+
+	// As if Init is called for the first time
+	atomic.StoreInt32(&initState, initRunning)
+	done := make(chan error, 1)
+	go func() {
+		done <- Init(Options{NoSignal: true, NoMemor: true, NoVersion: true, NoFlags: true, NoConfigWatch: true})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Init blocked by handler")
+	}
+}
@@ -33,6 +33,10 @@ var (
 	ErrUnknown = fmt.Errorf("kv: unknown error")
 )
 
+func init() {
+	base.DefaultRegister("kv.<name>.path", "", "Path of LevelDB, relative to base_dir")
+}
+
 // Initialize default leveldb
 func trigger() {
 	once.Do(func() {
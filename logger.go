@@ -0,0 +1,879 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func init() {
+	DefaultRegister("log.level", "info", "Log level: panic, fatal, error, warn, info, debug or trace")
+	DefaultRegister("log.levels.<context>", "", "Log level of tasks by context, which could end with `*` to match by prefix, e.g. client/*")
+	DefaultRegister("log.dir", "", "Directory of log file and alive file, relative to base_dir")
+	DefaultRegister("log.rotate", true, "Rotate log file by size, disable it to rotate by external tools, and reopen log file by SIGUSR2")
+	DefaultRegister("log.maxsize", 100, "Max size in megabytes of log file before it gets rotated")
+	DefaultRegister("log.maxage", 0, "Max days to retain rotated log files, 0 to retain all")
+	DefaultRegister("log.maxbackups", 0, "Max number of rotated log files to retain, 0 to retain all")
+	DefaultRegister("log.compress", false, "Compress rotated log files by gzip")
+
+	DefaultRegister("log.stderr.enabled", "auto", "Write log into stderr: true, false or auto, which is true if stderr is a terminal, or in containers or systemd services")
+	DefaultRegister("log.stderr.level", "", "Most verbose level of stderr, it limits log.level and log.levels")
+	DefaultRegister("log.stderr.format", "", "Log format of stderr, log.format if empty")
+	DefaultRegister("log.stdout.enabled", false, "Write log into stdout")
+	DefaultRegister("log.stdout.level", "", "Most verbose level of stdout, it limits log.level and log.levels")
+	DefaultRegister("log.stdout.format", "", "Log format of stdout, log.format if empty")
+	DefaultRegister("log.file.enabled", "auto", "Write log into file under log.dir: true, false or auto, which is false in containers")
+	DefaultRegister("log.file.level", "", "Most verbose level of log file, it limits log.level and log.levels")
+	DefaultRegister("log.file.format", "", "Log format of log file, log.format if empty")
+
+	DefaultRegister("log.format", "text", "Log format: text, json or logfmt")
+	DefaultRegister("log.time_format", time.RFC3339, "Layout of timestamp, in format of Go time package")
+	DefaultRegister("log.field_names.time", logrus.FieldKeyTime, "Field name of timestamp")
+	DefaultRegister("log.field_names.level", logrus.FieldKeyLevel, "Field name of level")
+	DefaultRegister("log.field_names.msg", logrus.FieldKeyMsg, "Field name of message")
+	DefaultRegister("log.field_names.caller", "caller", "Field name of caller")
+	DefaultRegister("log.field_names.func", "func", "Field name of function of caller")
+	DefaultRegister("log.caller_level", "trace", "Most verbose level to report caller, none to disable")
+	DefaultRegister("log.static_fields", []string{}, "Static fields added to every entry: app, version, hostname and pid")
+}
+
+// logger is used to initialize logger
+type logger struct {
+	*TaskBase
+	lumberjack.Logger
+
+	loglevel logrus.Level
+
+	// levels by context and level of others, used by outputs
+	levels   []loggerLevel
+	level    logrus.Level
+	levelMtx sync.RWMutex
+
+	// levels set by SetLogLevel temporarily, by context
+	temps map[string]*loggerTemp
+
+	// log file opened directly if rotated externally
+	rotate   bool
+	plain    *os.File
+	plainMtx sync.Mutex
+
+	// hooks of stderr, stdout, log file, syslog and journald
+	outputs []*loggerOutput
+	syslog  *syslogger
+	journal *journaler
+
+	// recent entries
+	ring *ringer
+
+	// redaction of sensitive fields and values
+	redact *redactor
+
+	// failures of outputs and hooks
+	failure loggerFailure
+
+	// names of caller fields, levels of caller and static fields, used by Fire
+	caller      string
+	function    string
+	callerOn    bool
+	callerLevel logrus.Level
+	fields      logrus.Fields
+	fieldMtx    sync.RWMutex
+
+	// logrus is touched only if enabled
+	enabled bool
+
+	set bool
+	mtx sync.Mutex
+}
+
+func (l *logger) Reload(ctx context.Context) error {
+	return nil
+}
+
+func (l *logger) Retire(ctx context.Context) error {
+	return nil
+}
+
+func (l *logger) Schedule(ctx context.Context) error {
+	if l.enabled == false {
+		return nil
+	}
+	if l.set == false {
+		l.init()
+	}
+	l.adjustOutPut()
+	l.adjustFormat()
+	l.adjustLogLevel()
+	return nil
+}
+
+func (l *logger) init() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.set == true {
+		return
+	}
+	l.set = true
+	l.caller, l.function = "caller", "func"
+	l.level = logrus.InfoLevel
+
+	// Entries are written by outputs, output of logrus is discarded
+	logrus.SetFormatter(loggerDiscard{})
+	logrus.SetOutput(ioutil.Discard)
+
+	// Caller is reported by Fire for levels configured
+	logrus.SetReportCaller(false)
+
+	// Register fatal handler
+	logrus.RegisterExitHandler(func() { Retire(1) })
+
+	// Hooks, fields are prepared by logger before outputs
+	l.outputs = []*loggerOutput{
+		{l: l, name: "stderr", writer: os.Stderr, tty: loggerTerminal(os.Stderr)},
+		{l: l, name: "stdout", writer: os.Stdout, tty: loggerTerminal(os.Stdout)},
+		{l: l, name: "file", writer: l},
+	}
+	l.syslog = &syslogger{l: l}
+	l.journal = &journaler{l: l}
+	logrus.AddHook(l)
+	for _, output := range l.outputs {
+		logrus.AddHook(output)
+	}
+	logrus.AddHook(l.syslog)
+	logrus.AddHook(l.journal)
+}
+
+func (l *logger) adjustLogLevel() {
+	if l.enabled == false {
+		return
+	}
+	l.mtx.Lock()
+	if level, err := logrus.ParseLevel(viper.GetString("log.level")); err != nil {
+		l.loglevel = logrus.InfoLevel
+	} else {
+		l.loglevel = level
+	}
+
+	// Lite mode limits levels to info at most
+	lite := strings.HasSuffix(GetExecName(), "test") == false && IsLiteMode() == true
+	limit := func(level logrus.Level) logrus.Level {
+		if lite == true && logrus.InfoLevel < level {
+			return logrus.InfoLevel
+		}
+		return level
+	}
+
+	var errs []string
+	patterns := map[string]logrus.Level{}
+	for pattern, name := range viper.GetStringMapString("log.levels") {
+		lv, err := logrus.ParseLevel(name)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", pattern, err))
+			continue
+		}
+		patterns[strings.ToLower(pattern)] = limit(lv)
+	}
+
+	// Temporary levels are not limited by lite mode
+	level := limit(l.loglevel)
+	for context, temp := range l.temps {
+		if context == "" {
+			level = temp.level
+		} else {
+			patterns[context] = temp.level
+		}
+	}
+
+	max := level
+	if viper.GetBool("log.ring.all_levels") == true && 0 < viper.GetInt("log.ring.size") {
+		// Entries of all levels are kept in memory
+		max = logrus.TraceLevel
+	}
+	var levels []loggerLevel
+	for pattern, lv := range patterns {
+		levels = append(levels, loggerLevel{pattern: pattern, level: lv})
+		if max < lv {
+			max = lv
+		}
+	}
+	// The most specific pattern comes first
+	sort.Slice(levels, func(i, j int) bool {
+		return loggerLevelLess(levels[j].pattern, levels[i].pattern)
+	})
+
+	l.levelMtx.Lock()
+	l.levels, l.level = levels, level
+	l.levelMtx.Unlock()
+
+	// Entries are filtered by formatters, logrus passes the most verbose one
+	logrus.SetLevel(max)
+	l.mtx.Unlock()
+
+	if 0 < len(errs) {
+		l.Log.WithFields(map[string]interface{}{"errors": errs}).Warn("Bad config of log levels")
+	}
+}
+
+// loggerTemp is a level set temporarily
+type loggerTemp struct {
+	level logrus.Level
+	until time.Time
+	timer *time.Timer
+}
+
+// setTemp set level of context until duration passed
+func (l *logger) setTemp(context string, level logrus.Level, duration time.Duration) error {
+	if l.enabled == false {
+		return fmt.Errorf("Logger is not enabled")
+	}
+
+	l.mtx.Lock()
+	if l.temps == nil {
+		l.temps = map[string]*loggerTemp{}
+	}
+	if temp, ok := l.temps[context]; ok == true {
+		temp.timer.Stop()
+	}
+	temp := &loggerTemp{level: level, until: time.Now().Add(duration)}
+	temp.timer = time.AfterFunc(duration, func() { l.revert(context, temp) })
+	l.temps[context] = temp
+	l.mtx.Unlock()
+
+	l.adjustLogLevel()
+	l.Log.WithFields(map[string]interface{}{"loglevel": level, "target": context, "until": temp.until.Format(time.RFC3339)}).
+		Warn("Log level changed temporarily")
+	return nil
+}
+
+// revert remove temporary level of context, any one if temp is nil
+func (l *logger) revert(context string, temp *loggerTemp) {
+	l.mtx.Lock()
+	current, ok := l.temps[context]
+	if ok == false || (temp != nil && current != temp) {
+		l.mtx.Unlock()
+		return
+	}
+	current.timer.Stop()
+	delete(l.temps, context)
+	l.mtx.Unlock()
+
+	l.adjustLogLevel()
+	l.Log.WithFields(map[string]interface{}{"loglevel": current.level, "target": context}).
+		Warn("Log level reverted to config")
+}
+
+// SetLogLevel change log level of tasks by context, or globally if context is
+// empty, it reverts to config after duration passed
+//
+// Context could be a pattern as same as keys of `log.levels`. Temporary levels
+// are not limited by lite mode.
+func SetLogLevel(level string, context string, duration time.Duration) error {
+	initTrigger()
+	lv, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if duration <= 0 {
+		return fmt.Errorf("Duration of log level must be positive")
+	}
+	return loggerInstance.setTemp(strings.ToLower(context), lv, duration)
+}
+
+// ResetLogLevel revert log level set by SetLogLevel to config at once
+func ResetLogLevel(context string) {
+	initTrigger()
+	loggerInstance.revert(strings.ToLower(context), nil)
+}
+
+// GetLogLevels return effective log levels by context pattern, global level
+// is under empty key
+func GetLogLevels() map[string]string {
+	initTrigger()
+	l := loggerInstance
+	l.levelMtx.RLock()
+	defer l.levelMtx.RUnlock()
+	if l.enabled == false {
+		return map[string]string{"": logrus.GetLevel().String()}
+	}
+	levels := map[string]string{"": l.level.String()}
+	for _, lv := range l.levels {
+		levels[lv.pattern] = lv.level.String()
+	}
+	return levels
+}
+
+// loggerLevel is level of contexts matched by pattern
+type loggerLevel struct {
+	pattern string
+	level   logrus.Level
+}
+
+// loggerLevelLess return whether pattern a is less specific than b, exact
+// patterns are more specific than prefixes and globs, longer ones are more
+// specific than shorter ones
+func loggerLevelLess(a, b string) bool {
+	ga, gb := strings.ContainsAny(a, "*?["), strings.ContainsAny(b, "*?[")
+	if ga != gb {
+		return ga
+	}
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// enabledFor return whether entry is enabled by level of its context
+func (l *logger) enabledFor(entry *logrus.Entry) bool {
+	context, _ := entry.Data["context"].(string)
+
+	l.levelMtx.RLock()
+	defer l.levelMtx.RUnlock()
+	level := l.level
+	if context != "" {
+		context = strings.ToLower(context)
+		for _, lv := range l.levels {
+			if loggerLevelMatch(lv.pattern, context) == true {
+				level = lv.level
+				break
+			}
+		}
+	}
+	return entry.Level <= level
+}
+
+// loggerLevelMatch return whether context matches pattern, pattern ending
+// with `*` matches by prefix, or else by path.Match
+func loggerLevelMatch(pattern, context string) bool {
+	if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern &&
+		strings.ContainsAny(prefix, "*?[") == false {
+		return strings.HasPrefix(context, prefix)
+	}
+	ok, _ := path.Match(pattern, context)
+	return ok
+}
+
+// loggerDropKey marks entries dropped by sampler
+const loggerDropKey = "_dropped"
+
+// loggerOutput is a hook to write entries into writer, entries disabled by
+// level of context or by sampler are dropped
+type loggerOutput struct {
+	l      *logger
+	name   string
+	writer io.Writer
+	tty    bool
+
+	enabled   bool
+	limited   bool
+	level     logrus.Level
+	formatter logrus.Formatter
+	mtx       sync.Mutex
+}
+
+// Logrus Hook / Levels
+func (o *loggerOutput) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Logrus Hook / Fire
+func (o *loggerOutput) Fire(entry *logrus.Entry) error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if o.enabled == false || o.formatter == nil || (o.limited == true && o.level < entry.Level) {
+		return nil
+	}
+	if o.l.passed(entry) == false {
+		return nil
+	}
+
+	// Failure is reported aside, logrus skips the rest hooks if any returns error
+	buf, err := o.formatter.Format(entry)
+	if err == nil {
+		_, err = o.writer.Write(buf)
+	}
+	if err != nil {
+		o.l.failure.report(o.name, err)
+	}
+	return nil
+}
+
+// loggerFailureInterval is min interval of reporting failures of each output
+const loggerFailureInterval = time.Minute
+
+// loggerFailure reports failures of outputs and hooks into stderr directly,
+// once per interval for each, entries failed are dropped
+type loggerFailure struct {
+	// writer is stderr if nil
+	writer io.Writer
+
+	last   map[string]time.Time
+	counts map[string]int
+	mtx    sync.Mutex
+}
+
+// report failure of output or hook by name
+func (f *loggerFailure) report(name string, err error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.last == nil {
+		f.last, f.counts = map[string]time.Time{}, map[string]int{}
+	}
+
+	now := time.Now()
+	if last, ok := f.last[name]; ok == true && now.Sub(last) < loggerFailureInterval {
+		f.counts[name]++
+		return
+	}
+	writer := f.writer
+	if writer == nil {
+		writer = os.Stderr
+	}
+	fmt.Fprintf(writer, "time=%q level=warning msg=\"Failed to write log into %s, entries are dropped\" error=%q suppressed=%d\n",
+		now.Format(time.RFC3339), name, err.Error(), f.counts[name])
+	f.last[name], f.counts[name] = now, 0
+}
+
+// setup set whether output is enabled and its level, "auto" is resolved by
+// auto, level is not limited if empty
+func (o *loggerOutput) setup(enabled string, auto bool, level string) error {
+	on, err := strconv.ParseBool(enabled)
+	if enabled == "auto" || enabled == "" {
+		on, err = auto, nil
+	}
+	lv, e := logrus.ParseLevel(level)
+	if level != "" && e != nil && err == nil {
+		err = e
+	}
+
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.enabled = on
+	o.limited, o.level = level != "" && e == nil, lv
+	return err
+}
+
+// loggerTerminal return whether file is a terminal
+func loggerTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// loggerContainer return whether app runs in a container
+func loggerContainer() bool {
+	for _, env := range []string{"container", "KUBERNETES_SERVICE_HOST"} {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+	for _, file := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(file); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// loggerDiscard is a formatter of logrus output, which is discarded
+type loggerDiscard struct{}
+
+func (loggerDiscard) Format(entry *logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// passed return whether entry passed level of its context and sampler
+func (l *logger) passed(entry *logrus.Entry) bool {
+	if _, ok := entry.Data[loggerDropKey]; ok == true {
+		return false
+	}
+	return l.enabledFor(entry)
+}
+
+func (l *logger) adjustOutPut() {
+	filename := GetPath(viper.GetString("log.dir"), fmt.Sprintf("%s.log", GetAppName()))
+	rotate := viper.GetBool("log.rotate")
+
+	l.plainMtx.Lock()
+	if l.plain != nil && (rotate == true || l.Filename != filename) {
+		l.plain.Close()
+		l.plain = nil
+	}
+	if rotate == false || l.Filename != filename {
+		l.Logger.Close()
+	}
+	l.rotate = rotate
+	l.Filename = filename
+	l.MaxAge = viper.GetInt("log.maxage")
+	l.MaxSize = viper.GetInt("log.maxsize")
+	l.MaxBackups = viper.GetInt("log.maxbackups")
+	l.Compress = viper.GetBool("log.compress")
+	l.plainMtx.Unlock()
+
+	// Containers and systemd capture stderr
+	container := loggerContainer()
+	service := os.Getenv("JOURNAL_STREAM") != "" || os.Getenv("INVOCATION_ID") != ""
+	auto := map[string]bool{
+		"stderr": l.outputs[0].tty == true || loggerTerminal(os.Stdout) == true || container == true || service == true,
+		"stdout": false,
+		"file":   container == false,
+	}
+	for _, output := range l.outputs {
+		prefix := fmt.Sprintf("log.%s.", output.name)
+		if err := output.setup(viper.GetString(prefix+"enabled"), auto[output.name], viper.GetString(prefix+"level")); err != nil {
+			l.Log.WithFields(map[string]interface{}{"output": output.name}).WithError(err).Warn("Bad config of log output")
+		}
+	}
+
+	tag := viper.GetString("log.syslog.tag")
+	if tag == "" {
+		tag = GetAppName()
+	}
+	if err := l.syslog.setup(
+		viper.GetBool("log.syslog.enabled"),
+		viper.GetString("log.syslog.network"),
+		viper.GetString("log.syslog.address"),
+		viper.GetString("log.syslog.facility"),
+		tag,
+	); err != nil {
+		l.Log.WithError(err).Warn("Bad config of syslog")
+	}
+	l.journal.setup(viper.GetBool("log.journald.enabled"), viper.GetString("log.journald.socket"), tag)
+
+	l.ring.setup(viper.GetInt("log.ring.size"), viper.GetBool("log.ring.all_levels"))
+}
+
+// Write into log file, it is opened by the first entry
+func (l *logger) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	l.plainMtx.Lock()
+	defer l.plainMtx.Unlock()
+	if l.rotate == true {
+		return l.Logger.Write(p)
+	}
+	if l.plain == nil {
+		if err := os.MkdirAll(filepath.Dir(l.Filename), 0755); err != nil {
+			return 0, err
+		}
+		f, err := os.OpenFile(l.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return 0, err
+		}
+		l.plain = f
+	}
+	return l.plain.Write(p)
+}
+
+// reopen close log file, it is opened again by the next entry
+func (l *logger) reopen() error {
+	if l.enabled == false {
+		return fmt.Errorf("Logger is not enabled")
+	}
+
+	l.plainMtx.Lock()
+	var err error
+	filename := l.Filename
+	if l.plain != nil {
+		err = l.plain.Close()
+		l.plain = nil
+	} else {
+		err = l.Logger.Close()
+	}
+	l.plainMtx.Unlock()
+
+	if err != nil {
+		return err
+	}
+	l.Log.WithFields(map[string]interface{}{"file": filename}).Info("Log file reopened")
+	return nil
+}
+
+// ReopenLogFile close and open log file again, it is called on signal SIGUSR2
+//
+// It is used to cooperate with external rotation, such as logrotate, with
+// `log.rotate` disabled.
+func ReopenLogFile() error {
+	initTrigger()
+	return loggerInstance.reopen()
+}
+
+// adjustFormat set formatters of outputs, caller and static fields by config
+func (l *logger) adjustFormat() {
+	var errs []string
+
+	format := viper.GetString("log.format")
+	for _, output := range l.outputs {
+		f := viper.GetString(fmt.Sprintf("log.%s.format", output.name))
+		if f == "" {
+			f = format
+		}
+		formatter, err := loggerFormatter(f, output.tty)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", output.name, err))
+			formatter, _ = loggerFormatter("text", output.tty)
+		}
+		output.mtx.Lock()
+		output.formatter = formatter
+		output.mtx.Unlock()
+	}
+
+	fields := logrus.Fields{}
+	for _, name := range viper.GetStringSlice("log.static_fields") {
+		switch name {
+		case "app":
+			fields[name] = GetAppName()
+		case "version":
+			fields[name] = GetVersion()
+		case "hostname":
+			fields[name], _ = os.Hostname()
+		case "pid":
+			fields[name] = os.Getpid()
+		default:
+			errs = append(errs, fmt.Sprintf("unknown static field %v", name))
+		}
+	}
+	caller := viper.GetString("log.field_names.caller")
+	if caller == "" {
+		caller = "caller"
+	}
+	function := viper.GetString("log.field_names.func")
+	if function == "" {
+		function = "func"
+	}
+	callerOn, callerLevel := true, logrus.TraceLevel
+	if name := viper.GetString("log.caller_level"); name == "none" {
+		callerOn = false
+	} else if name != "" {
+		if lv, err := logrus.ParseLevel(name); err != nil {
+			errs = append(errs, fmt.Sprintf("caller_level: %v", err))
+		} else {
+			callerLevel = lv
+		}
+	}
+
+	if err := l.redact.setup(
+		viper.GetBool("log.redact.enabled"),
+		viper.GetString("log.redact.replacement"),
+		viper.GetStringSlice("log.redact.fields"),
+		viper.GetStringSlice("log.redact.patterns"),
+	); err != nil {
+		errs = append(errs, fmt.Sprintf("redact: %v", err))
+	}
+
+	l.fieldMtx.Lock()
+	l.caller, l.function, l.fields = caller, function, fields
+	l.callerOn, l.callerLevel = callerOn, callerLevel
+	l.fieldMtx.Unlock()
+
+	if 0 < len(errs) {
+		l.Log.WithFields(map[string]interface{}{"errors": errs}).Warn("Bad config of log format")
+	}
+}
+
+// loggerFormatter return formatter by name of format, text is colored on terminal
+func loggerFormatter(format string, tty bool) (logrus.Formatter, error) {
+	layout := viper.GetString("log.time_format")
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	fieldMap := logrus.FieldMap{}
+	if name := viper.GetString("log.field_names.time"); name != "" {
+		fieldMap[logrus.FieldKeyTime] = name
+	}
+	if name := viper.GetString("log.field_names.level"); name != "" {
+		fieldMap[logrus.FieldKeyLevel] = name
+	}
+	if name := viper.GetString("log.field_names.msg"); name != "" {
+		fieldMap[logrus.FieldKeyMsg] = name
+	}
+
+	switch format {
+	case "", "text":
+		return &logrus.TextFormatter{
+			ForceColors:     tty,
+			FullTimestamp:   true,
+			TimestampFormat: layout,
+			FieldMap:        fieldMap,
+		}, nil
+	case "logfmt":
+		return &logrus.TextFormatter{
+			DisableColors:    true,
+			FullTimestamp:    true,
+			QuoteEmptyFields: true,
+			TimestampFormat:  layout,
+			FieldMap:         fieldMap,
+		}, nil
+	case "json":
+		return &logrus.JSONFormatter{
+			TimestampFormat: layout,
+			FieldMap:        fieldMap,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown format %v", format)
+}
+
+// Logrus Hook / Levels
+func (l *logger) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Logrus Hook / Fire
+func (l *logger) Fire(entry *logrus.Entry) error {
+	// Entries disabled by level of context are dropped before any cost, unless
+	// all levels are kept in memory
+	enabled := l.enabledFor(entry)
+	if enabled == false && l.ring.keepsAll() == false {
+		entry.Data[loggerDropKey] = true
+		return nil
+	}
+
+	l.fieldMtx.RLock()
+	caller, function, fields := l.caller, l.function, l.fields
+	callerOn, callerLevel := l.callerOn, l.callerLevel
+	l.fieldMtx.RUnlock()
+
+	// Caller is set by "src" field, or looked up for levels configured
+	if src, ok := entry.Data["src"]; ok == true {
+		entry.Data[caller] = src
+	} else if callerOn == true && entry.Level <= callerLevel {
+		if frame, ok := loggerCaller(); ok == true {
+			file, fn := loggerSource(frame)
+			entry.Data[caller] = fmt.Sprintf("%v:%v", file, frame.Line)
+			entry.Data[function] = fn
+		}
+	}
+	entry.Caller = nil
+
+	// Repeated messages are limited by sampler
+	if samplerInstance != nil && enabled == true {
+		if samplerInstance.sample(entry, fmt.Sprintf("%v", entry.Data[caller])) == false {
+			entry.Data[loggerDropKey] = true
+			return nil
+		}
+	}
+
+	// Static fields won't override fields of entry
+	for key, value := range fields {
+		if _, ok := entry.Data[key]; ok == false {
+			entry.Data[key] = value
+		}
+	}
+
+	// Make values clearer by `printf("%+v")`, and mask secrets and sensitive
+	// values before formatting
+	for key, value := range entry.Data {
+		entry.Data[key] = Redact(fmt.Sprintf("%+v", value))
+	}
+	entry.Message = Redact(entry.Message)
+	l.redact.redact(entry)
+
+	// Recent entries in memory
+	l.ring.add(entry, enabled)
+
+	// Hooks registered by LogHookRegister, failure of one is reported aside,
+	// so that outputs are kept
+	if enabled == false {
+		return nil
+	}
+	logHooks.Range(func(key, value interface{}) bool {
+		hook := value.(logrus.Hook)
+		for _, level := range hook.Levels() {
+			if level == entry.Level {
+				if err := hook.Fire(entry); err != nil {
+					l.failure.report(fmt.Sprintf("hook %v", key), err)
+				}
+				break
+			}
+		}
+		return true
+	})
+	return nil
+}
+
+// loggerCaller return frame of the function which called logrus
+func loggerCaller() (runtime.Frame, bool) {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	// Frames of logger itself, then logrus, then the caller
+	var inLogrus bool
+	for {
+		frame, more := frames.Next()
+		logrusFrame := strings.HasPrefix(frame.Function, "github.com/sirupsen/logrus.")
+		if inLogrus == true && logrusFrame == false {
+			return frame, true
+		}
+		inLogrus = inLogrus || logrusFrame
+		if more == false {
+			return runtime.Frame{}, false
+		}
+	}
+}
+
+// loggerSources caches source of callers by PC
+var loggerSources sync.Map
+
+// loggerSource return source path and function name of frame
+//
+// Source path is made of import path of package and name of file, with
+// module path of main package trimmed, so it is same no matter where and
+// how it was built. Function name is prefixed with name of package.
+func loggerSource(frame runtime.Frame) (string, string) {
+	if value, ok := loggerSources.Load(frame.PC); ok == true {
+		source := value.([2]string)
+		return source[0], source[1]
+	}
+
+	file, fn := frame.File, frame.Function
+	if slash := strings.LastIndex(fn, "/"); fn != "" {
+		pkg := fn
+		if dot := strings.Index(fn[slash+1:], "."); 0 <= dot {
+			pkg = fn[:slash+1+dot]
+		}
+		fn = fn[slash+1:]
+
+		if pkg == "main" && buildMain != "" {
+			pkg = buildMain
+		}
+		file = path.Join(pkg, filepath.Base(file))
+		if buildPath != "" && strings.HasPrefix(file, buildPath+"/") {
+			file = strings.TrimPrefix(file, buildPath+"/")
+		}
+	}
+
+	loggerSources.Store(frame.PC, [2]string{file, fn})
+	return file, fn
+}
+
+// logHooks holds hooks by key
+var logHooks sync.Map
+
+// LogHookRegister is used to register a hook of logrus, which is fired by
+// entries passed levels of contexts and sampling, after fields are formatted
+//
+// Hooks take effect only if logger is enabled, see Options.NoLogger. Error of
+// a hook is reported into stderr once a minute, other hooks are not affected.
+func LogHookRegister(hook logrus.Hook, key string) {
+	logHooks.Store(key, hook)
+}
+
+// LogHookCancel is used to cancel a hook of logrus
+func LogHookCancel(key string) {
+	logHooks.Delete(key)
+}
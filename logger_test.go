@@ -0,0 +1,151 @@
+package base
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testLogger return a logger with callers on, without outputs
+func testLogger() *logger {
+	return &logger{
+		level:       logrus.InfoLevel,
+		caller:      "caller",
+		function:    "func",
+		callerOn:    true,
+		callerLevel: logrus.TraceLevel,
+		ring:        &ringer{},
+		redact:      &redactor{},
+	}
+}
+
+func TestLoggerFireDisabled(t *testing.T) {
+	l := testLogger()
+
+	entry := &logrus.Entry{Data: logrus.Fields{"k": 1}, Time: time.Now(), Level: logrus.TraceLevel, Message: "m"}
+	if err := l.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry.Data[loggerDropKey]; ok == false || len(entry.Data) != 2 || entry.Data["k"] != 1 {
+		t.Errorf("disabled entry is processed: %v", entry.Data)
+	}
+
+	entry = &logrus.Entry{Data: logrus.Fields{"k": 1}, Time: time.Now(), Level: logrus.InfoLevel, Message: "m"}
+	if err := l.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry.Data[loggerDropKey]; ok == true || entry.Data["k"] != "1" {
+		t.Errorf("enabled entry is not processed: %v", entry.Data)
+	}
+
+	// Kept in memory if all levels are kept
+	l.ring.setup(10, true)
+	entry = &logrus.Entry{Data: logrus.Fields{}, Time: time.Now(), Level: logrus.TraceLevel, Message: "m"}
+	l.Fire(entry)
+	if entries, _ := l.ring.query(LogQuery{}); len(entries) != 1 {
+		t.Errorf("ring has %d entries, want 1", len(entries))
+	}
+}
+
+// testFailWriter fails to write
+type testFailWriter struct{}
+
+func (testFailWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("no space left on device")
+}
+
+// testFailHook fails to fire
+type testFailHook struct{}
+
+func (testFailHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (testFailHook) Fire(entry *logrus.Entry) error {
+	return fmt.Errorf("collector is down")
+}
+
+func TestLoggerOutputFailure(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "syslog.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var stdout, failures bytes.Buffer
+	l := testLogger()
+	l.failure.writer = &failures
+	l.outputs = []*loggerOutput{
+		{l: l, name: "file", writer: testFailWriter{}},
+		{l: l, name: "stdout", writer: &stdout},
+	}
+	l.syslog = &syslogger{l: l}
+	l.syslog.setup(true, "unixgram", socket, "local0", "test")
+	if testSyslogWait(t, l.syslog) == false {
+		t.Fatal("Failed to connect syslog")
+	}
+	LogHookRegister(testFailHook{}, "test/failure")
+	defer LogHookCancel("test/failure")
+
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	log.AddHook(l)
+	for _, output := range l.outputs {
+		output.enabled, output.formatter = true, &logrus.TextFormatter{DisableColors: true}
+		log.AddHook(output)
+	}
+	log.AddHook(l.syslog)
+
+	for i := 0; i < 3; i++ {
+		log.Info("hello")
+	}
+	if n := strings.Count(stdout.String(), "hello"); n != 3 {
+		t.Errorf("stdout has %d entries, want 3", n)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 0; i < 3; i++ {
+		buf := make([]byte, 4096)
+		if n, err := conn.Read(buf); err != nil || bytes.Contains(buf[:n], []byte("hello")) == false {
+			t.Fatalf("syslog got %q, %v", buf[:n], err)
+		}
+	}
+	if n := strings.Count(failures.String(), "Failed to write log into file"); n != 1 {
+		t.Errorf("failure of file is reported %d times, want once: %s", n, failures.String())
+	}
+	if n := strings.Count(failures.String(), "Failed to write log into hook test/failure"); n != 1 {
+		t.Errorf("failure of hook is reported %d times, want once: %s", n, failures.String())
+	}
+}
+
+func TestLoggerLevelMatch(t *testing.T) {
+	cases := []struct {
+		pattern, context string
+		ok               bool
+	}{
+		{"client/*", "client/s3", true},
+		{"client/*", "client", false},
+		{"client/*/get", "client/s3/get", true},
+		{"task", "task", true},
+		{"task", "task/1", false},
+	}
+	for _, c := range cases {
+		if ok := loggerLevelMatch(c.pattern, c.context); ok != c.ok {
+			t.Errorf("loggerLevelMatch(%q, %q) = %v, want %v", c.pattern, c.context, ok, c.ok)
+		}
+	}
+}
+
+func BenchmarkLoggerFireDisabled(b *testing.B) {
+	l := testLogger()
+	for i := 0; i < b.N; i++ {
+		l.Fire(&logrus.Entry{Data: logrus.Fields{"k": i}, Level: logrus.TraceLevel, Message: "m"})
+	}
+}
@@ -0,0 +1,386 @@
+// Package logship ship logs to a collector by http client
+//
+// Entries are batched and posted in JSON lines compressed by gzip, by client
+// that named `log_shipping.<name>.client` in config file, `log_shipping_<name>`
+// by default. Entries are spooled on disk while collector is unreachable, and
+// posted again later. Config of shipping:
+//
+//	log_shipping:
+//	  <name>:
+//	    client:     name of http client
+//	    path:       path of request, default path of client if empty
+//	    interval:   interval of posting, 5s by default
+//	    batch:      max entries of a request, 1000 by default
+//	    queue:      max entries in memory, 10000 by default
+//	    block:      block logging while queue is full, or drop the oldest entries
+//	    spool:      file to spool entries, under log.dir by default
+//	    spool_size: max size of spool file in bytes, the oldest entries are dropped
+package logship
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/miinowy/go-base"
+	"github.com/miinowy/go-base/client"
+)
+
+var (
+	mtx     sync.Mutex
+	shipMap sync.Map
+
+	// ErrArgument indicates a argument error
+	ErrArgument = fmt.Errorf("logship: unexcept argument")
+	// ErrConfigure indicates a config error
+	ErrConfigure = fmt.Errorf("logship: unexcept configure")
+)
+
+func init() {
+	base.DefaultRegister("log_shipping.<name>.client", "", "Name of http client, log_shipping_<name> if empty")
+	base.DefaultRegister("log_shipping.<name>.path", "", "Path of request, default path of client if empty")
+	base.DefaultRegister("log_shipping.<name>.interval", "5s", "Interval of posting")
+	base.DefaultRegister("log_shipping.<name>.batch", 1000, "Max entries of a request")
+	base.DefaultRegister("log_shipping.<name>.queue", 10000, "Max entries in memory")
+	base.DefaultRegister("log_shipping.<name>.block", false, "Block logging while queue is full, or drop the oldest entries")
+	base.DefaultRegister("log_shipping.<name>.spool", "", "File to spool entries while collector is unreachable, under log.dir if empty")
+	base.DefaultRegister("log_shipping.<name>.spool_size", 64*1024*1024, "Max size of spool file in bytes, the oldest entries are dropped")
+}
+
+// Context of log shipping
+type Context struct {
+	*base.TaskBase
+
+	name string
+	task *base.Task
+
+	mtx       sync.Mutex
+	cond      *sync.Cond
+	client    *client.Context
+	path      string
+	batch     int
+	queue     int
+	block     bool
+	spool     string
+	spoolSize int64
+
+	// entries in memory, and number of dropped ones
+	entries [][]byte
+	dropped int
+	retired bool
+
+	formatter logrus.JSONFormatter
+}
+
+// NewContext return a new Context of log shipping, entries are shipped after
+// it returned
+func NewContext(name string) *Context {
+	if name == "" {
+		return nil
+	}
+
+	// Cache
+	if value, ok := shipMap.Load(name); ok == true {
+		return value.(*Context)
+	}
+
+	// Double cache
+	mtx.Lock()
+	defer mtx.Unlock()
+	if value, ok := shipMap.Load(name); ok == true {
+		return value.(*Context)
+	}
+
+	c := &Context{name: name, formatter: logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}}
+	c.cond = sync.NewCond(&c.mtx)
+	shipMap.Store(name, c)
+	task, err := base.NewTaskOnInterval(c, c.key(), 5*time.Second)
+	if err != nil {
+		return c
+	}
+	task.Subscribe(fmt.Sprintf("log_shipping.%s", name), "log.dir", "base_dir")
+
+	c.mtx.Lock()
+	c.task = task
+	c.mtx.Unlock()
+	base.LogHookRegister(c, c.key())
+
+	return c
+}
+
+// key of hook and task
+func (c *Context) key() string {
+	return fmt.Sprintf("log_shipping/%s", c.name)
+}
+
+// Reload to get lastest config by config file
+func (c *Context) Reload(ctx context.Context) error {
+	if c.name == "" {
+		return ErrArgument
+	}
+
+	prefix := fmt.Sprintf("log_shipping.%s.", c.name)
+	name := viper.GetString(prefix + "client")
+	if name == "" {
+		name = fmt.Sprintf("log_shipping_%s", c.name)
+	}
+	cli := client.NewContext(name)
+	if cli == nil {
+		return ErrConfigure
+	}
+
+	interval := 5 * time.Second
+	if du, err := time.ParseDuration(viper.GetString(prefix + "interval")); err == nil && 0 < du {
+		interval = du
+	}
+
+	spool := viper.GetString(prefix + "spool")
+	if spool == "" {
+		spool = filepath.Join(viper.GetString("log.dir"), fmt.Sprintf("%s.logship.%s", base.GetAppName(), c.name))
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.client = cli
+	c.path = viper.GetString(prefix + "path")
+	c.batch = viper.GetInt(prefix + "batch")
+	if c.batch <= 0 {
+		c.batch = 1000
+	}
+	c.queue = viper.GetInt(prefix + "queue")
+	if c.queue < c.batch {
+		c.queue = c.batch
+	}
+	c.block = viper.GetBool(prefix + "block")
+	c.spool = base.GetPath(spool)
+	c.spoolSize = viper.GetInt64(prefix + "spool_size")
+	c.SetInterval(interval)
+
+	// Queue may be larger now
+	c.cond.Broadcast()
+	return nil
+}
+
+// Retire spool entries in memory and post them, they are kept in spool file
+// if posting is failed or cut off by exit
+func (c *Context) Retire(ctx context.Context) error {
+	base.LogHookCancel(c.key())
+
+	c.mtx.Lock()
+	c.retired = true
+	entries, spool, size := c.entries, c.spool, c.spoolSize
+	c.entries = nil
+	c.cond.Broadcast()
+	c.mtx.Unlock()
+
+	if err := c.spoolAppend(spool, size, entries); err != nil {
+		c.Log.WithError(err).Warn("Failed to spool logs")
+	}
+
+	// Tasks are stopped in 3 seconds before exit
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return c.flush(ctx)
+}
+
+// Schedule post entries
+func (c *Context) Schedule(ctx context.Context) error {
+	return c.flush(ctx)
+}
+
+// Logrus Hook / Levels
+func (c *Context) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Logrus Hook / Fire
+func (c *Context) Fire(entry *logrus.Entry) error {
+	line, err := c.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	// Entries of shipping itself never block, or it may wait for itself
+	name, _ := entry.Data["context"].(string)
+	block := name != c.key() && strings.HasPrefix(name, "client/") == false
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for block == true && c.block == true && c.retired == false && c.queue <= len(c.entries) {
+		c.cond.Wait()
+	}
+	if c.queue <= len(c.entries) {
+		c.entries = c.entries[1:]
+		c.dropped++
+	}
+	c.entries = append(c.entries, line)
+
+	// Post at once if a batch is full
+	if len(c.entries) == c.batch && c.task != nil {
+		c.task.Fire()
+	}
+	return nil
+}
+
+// flush post entries in memory and spooled ones, entries are spooled if failed
+func (c *Context) flush(ctx context.Context) error {
+	c.mtx.Lock()
+	entries, dropped := c.entries, c.dropped
+	c.entries, c.dropped = nil, 0
+	cli, path, batch, spool, size := c.client, c.path, c.batch, c.spool, c.spoolSize
+	c.cond.Broadcast()
+	c.mtx.Unlock()
+
+	if 0 < dropped {
+		c.Log.WithFields(map[string]interface{}{"dropped": dropped}).Warn("Log entries dropped as queue is full")
+	}
+	if cli == nil {
+		return ErrConfigure
+	}
+	if path == "" {
+		path = cli.Path()
+	}
+
+	// New entries first, spooled ones are posted only if collector is reachable
+	if n, err := c.post(ctx, cli, path, entries, batch); err != nil {
+		c.Log.WithError(err).Warn("Failed to ship logs, spool them")
+		if err := c.spoolAppend(spool, size, entries[n:]); err != nil {
+			c.Log.WithError(err).Warn("Failed to spool logs")
+		}
+		return err
+	}
+
+	spooled, err := c.spoolRead(spool)
+	if err != nil || len(spooled) == 0 {
+		return err
+	}
+	n, err := c.post(ctx, cli, path, spooled, batch)
+	if n == 0 {
+		return err
+	}
+	if e := c.spoolWrite(spool, size, spooled[n:]); e != nil {
+		c.Log.WithError(e).Warn("Failed to spool logs")
+	}
+	return err
+}
+
+// post entries by batches, return number of entries posted
+func (c *Context) post(ctx context.Context, cli *client.Context, path string, entries [][]byte, batch int) (int, error) {
+	for n := 0; n < len(entries); n += batch {
+		end := n + batch
+		if len(entries) < end {
+			end = len(entries)
+		}
+
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		for _, line := range entries[n:end] {
+			zw.Write(line)
+		}
+		if err := zw.Close(); err != nil {
+			return n, err
+		}
+
+		request := cli.R().SetContext(ctx)
+		request.Header = cli.Header()
+		request.SetHeader("Content-Type", "application/x-ndjson")
+		request.SetHeader("Content-Encoding", "gzip")
+		response, err := request.SetBody(buf.Bytes()).Post(path)
+		if err != nil {
+			return n, err
+		}
+		if response.IsError() == true {
+			return n, fmt.Errorf("unexcept status: %v", response.Status())
+		}
+	}
+	return len(entries), nil
+}
+
+// spoolRead return entries in spool file
+func (c *Context) spoolRead(spool string) ([][]byte, error) {
+	f, err := os.Open(spool)
+	if os.IsNotExist(err) == true {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries [][]byte
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if 0 < len(line) && line[len(line)-1] == '\n' {
+			entries = append(entries, line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// spoolAppend append entries to spool file, it is trimmed if over size
+func (c *Context) spoolAppend(spool string, size int64, entries [][]byte) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(spool, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	for _, line := range entries {
+		if _, err := f.Write(line); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	fi, err := f.Stat()
+	f.Close()
+	if err != nil || fi.Size() <= size || size <= 0 {
+		return err
+	}
+
+	spooled, err := c.spoolRead(spool)
+	if err != nil {
+		return err
+	}
+	return c.spoolWrite(spool, size, spooled)
+}
+
+// spoolWrite replace spool file by entries atomically, the oldest entries are
+// dropped if over size
+func (c *Context) spoolWrite(spool string, size int64, entries [][]byte) error {
+	if len(entries) == 0 {
+		return os.Remove(spool)
+	}
+
+	var total int64
+	i := len(entries)
+	for ; 0 < i; i-- {
+		if 0 < size && size < total+int64(len(entries[i-1])) {
+			break
+		}
+		total += int64(len(entries[i-1]))
+	}
+	if 0 < i {
+		c.Log.WithFields(map[string]interface{}{"dropped": i}).Warn("Spooled log entries dropped as spool is full")
+	}
+
+	tmp := spool + ".tmp"
+	if err := ioutil.WriteFile(tmp, bytes.Join(entries[i:], nil), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, spool)
+}
@@ -0,0 +1,223 @@
+package base
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	DefaultRegister("memory.limit", 0, "Limit of memory in bytes, limit of cgroup if 0, or 1GiB without cgroup limit, 16MiB at least")
+	DefaultRegister("memory.soft_limit", 0.9, "Ratio of limit set as soft limit of runtime, 0 to disable, skipped if GOMEMLIMIT is set")
+	DefaultRegister("memory.thresholds.warn", 0.8, "Ratio of limit to warn, 0 to disable")
+	DefaultRegister("memory.thresholds.gc", 0, "Ratio of limit to force garbage collection, 0 to disable")
+	DefaultRegister("memory.thresholds.free", 0.9, "Ratio of limit to return memory to OS, 0 to disable")
+	DefaultRegister("memory.thresholds.restart", 1, "Ratio of limit to restart app, 0 to disable")
+	DefaultRegister("memory.profile.enabled", true, "Write heap profile before restart")
+	DefaultRegister("memory.profile.file", "", "File of heap profile, <app>.heap.pprof under log.dir if empty")
+}
+
+// memorActions by order, later actions may release memory for former ones
+var memorActions = []string{"warn", "gc", "free", "restart"}
+
+// memorThreshold is an action taken when memory is over ratio of limit
+type memorThreshold struct {
+	action string
+	ratio  float64
+}
+
+// memor is used to prevent memory leak
+//
+// Memory in use is memory obtained from OS and not released, as same as
+// which is limited by cgroup.
+type memor struct {
+	*TaskBase
+
+	limit      uint64
+	soft       bool
+	thresholds []memorThreshold
+	profile    string
+}
+
+func (l *memor) Reload(ctx context.Context) error {
+	limit, source := viper.GetUint64("memory.limit"), "config"
+	if limit == 0 {
+		limit, source = memorCgroupLimit(), "cgroup"
+	}
+	if limit == 0 {
+		limit, source = 1024*1024*1024, "default"
+	}
+	if limit < 16*1024*1024 {
+		limit = 16 * 1024 * 1024
+	}
+
+	var thresholds []memorThreshold
+	for _, action := range memorActions {
+		if ratio := viper.GetFloat64("memory.thresholds." + action); 0 < ratio {
+			thresholds = append(thresholds, memorThreshold{action: action, ratio: ratio})
+		}
+	}
+	sort.SliceStable(thresholds, func(i, j int) bool {
+		return thresholds[i].ratio < thresholds[j].ratio
+	})
+
+	profile := ""
+	if viper.GetBool("memory.profile.enabled") == true {
+		profile = viper.GetString("memory.profile.file")
+		if profile == "" {
+			profile = GetPath(viper.GetString("log.dir"), fmt.Sprintf("%s.heap.pprof", GetAppName()))
+		} else {
+			profile = GetPath(profile)
+		}
+	}
+
+	// Soft limit of runtime, GOMEMLIMIT takes precedence
+	soft := int64(math.MaxInt64)
+	if ratio := viper.GetFloat64("memory.soft_limit"); 0 < ratio {
+		soft = int64(float64(limit) * ratio)
+	}
+	if os.Getenv("GOMEMLIMIT") == "" && (soft != math.MaxInt64 || l.soft == true) {
+		debug.SetMemoryLimit(soft)
+		l.soft = soft != math.MaxInt64
+	}
+
+	l.limit, l.thresholds, l.profile = limit, thresholds, profile
+	l.Log.WithFields(map[string]interface{}{"limit": limit, "source": source, "soft_limit": debug.SetMemoryLimit(-1)}).
+		Debug("Memory limit set")
+	return nil
+}
+
+func (l *memor) Retire(ctx context.Context) error {
+	return nil
+}
+
+func (l *memor) Schedule(ctx context.Context) error {
+	used, m := memorUsed()
+	l.Log.WithFields(map[string]interface{}{"used": used, "alloc": m.Alloc, "gc": m.NumGC}).
+		Trace("Memory checking")
+
+	for _, threshold := range l.thresholds {
+		if float64(used) <= float64(l.limit)*threshold.ratio {
+			break
+		}
+		fields := map[string]interface{}{
+			"used":   used,
+			"alloc":  m.Alloc,
+			"gc":     m.NumGC,
+			"limit":  l.limit,
+			"action": threshold.action,
+		}
+
+		switch threshold.action {
+		case "warn":
+			l.Log.WithFields(fields).Warn("Memory over threshold")
+		case "gc":
+			runtime.GC()
+			used, m = memorUsed()
+			fields["after"] = used
+			l.Log.WithFields(fields).Warn("Memory over threshold, garbage collected")
+		case "free":
+			debug.FreeOSMemory()
+			used, m = memorUsed()
+			fields["after"] = used
+			l.Log.WithFields(fields).Warn("Memory over threshold, memory returned to OS")
+		case "restart":
+			l.Log.WithFields(fields).Warn("Memory over limit")
+			l.dump()
+			Daemon()
+			return nil
+		}
+	}
+	return nil
+}
+
+// dump write heap profile if enabled
+func (l *memor) dump() {
+	if l.profile == "" {
+		return
+	}
+	var buf bytes.Buffer
+	if err := pprof.WriteHeapProfile(&buf); err != nil {
+		l.Log.WithError(err).Warn("Failed to write heap profile")
+		return
+	}
+	if err := writeFileAtomic(l.profile, buf.Bytes(), 0644); err != nil {
+		l.Log.WithError(err).Warn("Failed to write heap profile")
+		return
+	}
+	l.Log.WithFields(map[string]interface{}{"file": l.profile}).Warn("Heap profile written")
+}
+
+// memorUsed return memory obtained from OS and not released
+func memorUsed() (uint64, runtime.MemStats) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys - m.HeapReleased, m
+}
+
+// memorCgroupLimit return memory limit of cgroup v2 or v1, 0 if unlimited
+func memorCgroupLimit() uint64 {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	// Lines are in form of `<id>:<controllers>:<path>`, controllers of v2 is
+	// empty, paths are relative to mount point, or "/" in namespace
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			files = append(files,
+				filepath.Join("/sys/fs/cgroup", parts[2], "memory.max"),
+				"/sys/fs/cgroup/memory.max")
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				files = append(files,
+					filepath.Join("/sys/fs/cgroup/memory", parts[2], "memory.limit_in_bytes"),
+					"/sys/fs/cgroup/memory/memory.limit_in_bytes")
+			}
+		}
+	}
+
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		value := strings.TrimSpace(string(buf))
+		if value == "max" {
+			return 0
+		}
+		limit, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		// Unlimited of v1 is a huge number rounded by page size
+		if 1<<62 <= limit {
+			return 0
+		}
+		return limit
+	}
+	return 0
+}
@@ -0,0 +1,270 @@
+package base
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// flagSet is parsed by Init, flags that are not defined are ignored
+var flagSet = newFlagSet()
+
+func newFlagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+	fs.ParseErrorsWhitelist.UnknownFlags = true
+	fs.Usage = func() {}
+
+	fs.String("config", "", "path of config file")
+	fs.Bool("config-sample", false, "print sample config and exit")
+	fs.StringArray("set", nil, "override config by `key=value`, could be repeated")
+	fs.String("version", "", "print version and exit, by format text or json")
+	fs.Lookup("version").NoOptDefVal = "text"
+
+	return fs
+}
+
+// FlagSet return the flag set parsed by Init
+//
+// Flags defined before Init are parsed with it, a changed flag that named by
+// config key (e.g. `--websvr.api.listen`) overrides the config, and
+// `--set key=value` overrides any config key
+func FlagSet() *pflag.FlagSet {
+	return flagSet
+}
+
+// flagParse parse command line arguments by flagSet only once
+func flagParse() error {
+	if flagSet.Parsed() == true {
+		return nil
+	}
+	return flagSet.Parse(flagArgs(os.Args[1:]))
+}
+
+// flagArgs return arguments without `-h` and `--help`, unless they are
+// defined in flagSet, so that help of host is not taken over
+func flagArgs(arguments []string) []string {
+	args := make([]string, 0, len(arguments))
+	for i, arg := range arguments {
+		if arg == "--" {
+			return append(args, arguments[i:]...)
+		}
+		if (arg == "--help" && flagSet.Lookup("help") == nil) ||
+			(arg == "-h" && flagSet.ShorthandLookup("h") == nil) {
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// flagSettings return config settings overridden by flags
+func flagSettings() map[string]interface{} {
+	settings := map[string]interface{}{}
+	if flagSet.Parsed() == false {
+		return settings
+	}
+
+	flagSet.Visit(func(flag *pflag.Flag) {
+		switch flag.Name {
+		case "config", "config-sample", "set", "version":
+		default:
+			settingsSet(settings, flag.Name, flag.Value.String())
+		}
+	})
+
+	sets, _ := flagSet.GetStringArray("set")
+	for _, set := range sets {
+		if i := strings.Index(set, "="); 0 < i {
+			settingsSet(settings, set[:i], set[i+1:])
+		}
+	}
+	return settings
+}
+
+// envSettings return config settings overridden by environment variables
+//
+// Variable is named by prefix and key, in upper case and separated by `_`,
+// e.g. `MYAPP_WEBSVR_API_LISTEN` for `websvr.api.listen`. Underscores are
+// ambiguous, so keys are resolved by order:
+//
+//  1. `__` separates levels explicitly, e.g. `MYAPP_HTTP_CLIENT__S3KV__HOST`
+//     for `http_client.s3kv.host`
+//  2. keys known by config files and defaults
+//  3. templates of defaults, e.g. `http_client.<name>.host`
+//  4. every `_` separates a level
+//
+// `<PREFIX>_ENV` selects the overlay file, it is not a config key.
+func envSettings(prefix string, keys []string) map[string]interface{} {
+	settings := map[string]interface{}{}
+	prefix = envName(prefix) + "_"
+
+	// Known key paths, indexed by env names of segments
+	known := map[string]string{}
+	full := map[string]bool{}
+	for _, key := range keys {
+		var name, path []string
+		for _, segment := range strings.Split(key, ".") {
+			name = append(name, envName(segment))
+			path = append(path, segment)
+			known[strings.Join(name, ".")] = strings.Join(path, ".")
+		}
+		full[key] = true
+	}
+	templates := envTemplates()
+
+	for _, env := range os.Environ() {
+		i := strings.Index(env, "=")
+		if i < 0 || strings.HasPrefix(env[:i], prefix) == false || i == len(prefix) || env[:i] == prefix+"ENV" {
+			continue
+		}
+		if key := envResolve(env[len(prefix):i], known, full, templates); key != "" {
+			settingsSet(settings, key, env[i+1:])
+		}
+	}
+	return settings
+}
+
+// envResolve return config key of name without prefix, empty if invalid
+func envResolve(name string, known map[string]string, full map[string]bool, templates [][]string) string {
+	if strings.Contains(name, "__") == true {
+		segments := strings.Split(strings.ToLower(name), "__")
+		for _, segment := range segments {
+			if segment == "" {
+				return ""
+			}
+		}
+		return strings.Join(segments, ".")
+	}
+
+	tokens := strings.Split(name, "_")
+	key := envKey(tokens, known)
+	if key == "" || full[key] == true {
+		return key
+	}
+	for _, template := range templates {
+		if path, ok := envTemplate(tokens, template); ok == true {
+			return strings.Join(path, ".")
+		}
+	}
+	return key
+}
+
+// envTemplates return registered templates of defaults, split into segments
+// and sorted for determinism
+func envTemplates() [][]string {
+	var keys []string
+	defaultMap.Range(func(key, value interface{}) bool {
+		if defaultTemplate(key.(string)) == true {
+			keys = append(keys, key.(string))
+		}
+		return true
+	})
+	sort.Strings(keys)
+
+	templates := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		templates = append(templates, strings.Split(key, "."))
+	}
+	return templates
+}
+
+// envTemplate match tokens with template, a placeholder segment such as
+// `<name>` matches one or more tokens, return key path if matched
+func envTemplate(tokens []string, template []string) ([]string, bool) {
+	if len(template) == 0 {
+		return nil, len(tokens) == 0
+	}
+	segment := template[0]
+	if strings.HasPrefix(segment, "<") == true && strings.HasSuffix(segment, ">") == true {
+		for n := 1; n <= len(tokens); n++ {
+			if path, ok := envTemplate(tokens[n:], template[1:]); ok == true {
+				name := strings.ToLower(strings.Join(tokens[:n], "_"))
+				return append([]string{name}, path...), true
+			}
+		}
+		return nil, false
+	}
+
+	words := strings.Split(envName(segment), "_")
+	if len(tokens) < len(words) {
+		return nil, false
+	}
+	for i, word := range words {
+		if tokens[i] != word {
+			return nil, false
+		}
+	}
+	path, ok := envTemplate(tokens[len(words):], template[1:])
+	if ok == false {
+		return nil, false
+	}
+	return append([]string{segment}, path...), true
+}
+
+// envKey return config key of tokens, the longest known segment is preferred
+func envKey(tokens []string, known map[string]string) string {
+	var name, path []string
+	for i := 0; i < len(tokens); {
+		j := i + 1
+		for k := len(tokens); i+1 < k; k-- {
+			if _, ok := known[strings.Join(append(name, strings.Join(tokens[i:k], "_")), ".")]; ok == true {
+				j = k
+				break
+			}
+		}
+		segment := strings.Join(tokens[i:j], "_")
+		if segment == "" {
+			return ""
+		}
+		name = append(name, segment)
+		if key, ok := known[strings.Join(name, ".")]; ok == true {
+			path = append(path[:0], strings.Split(key, ".")...)
+		} else {
+			path = append(path, strings.ToLower(segment))
+		}
+		i = j
+	}
+	return strings.Join(path, ".")
+}
+
+// envName return name in upper case, non-alphanumeric characters are replaced by `_`
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// settingsSet set value in nested settings by key separated by `.`
+func settingsSet(settings map[string]interface{}, key string, value interface{}) {
+	segments := strings.Split(strings.ToLower(key), ".")
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := settings[segment].(map[string]interface{})
+		if ok == false {
+			next = map[string]interface{}{}
+			settings[segment] = next
+		}
+		settings = next
+	}
+	settings[segments[len(segments)-1]] = value
+}
+
+// settingsDelete remove a dotted key from nested settings
+func settingsDelete(settings map[string]interface{}, key string) {
+	segments := strings.Split(strings.ToLower(key), ".")
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := settings[segment].(map[string]interface{})
+		if ok == false {
+			return
+		}
+		settings = next
+	}
+	delete(settings, segments[len(segments)-1])
+}
@@ -0,0 +1,78 @@
+package base
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvSettings(t *testing.T) {
+	DefaultRegister("test_client.<name>.host", "", "Host of test client")
+
+	keys := []string{"websvr.api.listen", "log.dir", "http_client.s3kv_default.timeout"}
+	cases := []struct {
+		env   string
+		key   string
+		value string
+	}{
+		// Keys known by files and defaults
+		{"BASETEST_WEBSVR_API_LISTEN", "websvr.api.listen", ":80"},
+		{"BASETEST_LOG_DIR", "log.dir", "/var/log"},
+		{"BASETEST_HTTP_CLIENT_S3KV_DEFAULT_TIMEOUT", "http_client.s3kv_default.timeout", "5s"},
+		// Templates of defaults
+		{"BASETEST_TEST_CLIENT_S3KV_DEFAULT_HOST", "test_client.s3kv_default.host", "http://s3"},
+		// Levels separated explicitly
+		{"BASETEST_HTTP_CLIENT__S3KV_OTHER__HOST", "http_client.s3kv_other.host", "http://other"},
+		// Unknown keys
+		{"BASETEST_FOO_BAR", "foo.bar", "1"},
+	}
+	want := map[string]interface{}{}
+	for _, c := range cases {
+		t.Setenv(c.env, c.value)
+		settingsSet(want, c.key, c.value)
+	}
+	// Overlay selector and malformed names are skipped
+	t.Setenv("BASETEST_ENV", "prod")
+	t.Setenv("BASETEST_BAD__", "1")
+
+	if got := envSettings("basetest", keys); reflect.DeepEqual(got, want) == false {
+		t.Errorf("envSettings() = %v, want %v", got, want)
+	}
+}
+
+func TestEnvTemplate(t *testing.T) {
+	cases := []struct {
+		tokens   []string
+		template []string
+		path     []string
+		ok       bool
+	}{
+		{[]string{"HTTP", "CLIENT", "A", "HOST"}, []string{"http_client", "<name>", "host"}, []string{"http_client", "a", "host"}, true},
+		{[]string{"HTTP", "CLIENT", "A", "B", "HOST"}, []string{"http_client", "<name>", "host"}, []string{"http_client", "a_b", "host"}, true},
+		{[]string{"HTTP", "CLIENT", "HOST"}, []string{"http_client", "<name>", "host"}, nil, false},
+		{[]string{"LOG", "LEVELS", "TASK"}, []string{"log", "levels", "<context>"}, []string{"log", "levels", "task"}, true},
+		{[]string{"LOG", "DIR"}, []string{"log", "levels", "<context>"}, nil, false},
+	}
+	for _, c := range cases {
+		path, ok := envTemplate(c.tokens, c.template)
+		if ok != c.ok || reflect.DeepEqual(path, c.path) == false {
+			t.Errorf("envTemplate(%v, %v) = %v, %v, want %v, %v", c.tokens, c.template, path, ok, c.path, c.ok)
+		}
+	}
+}
+
+func TestSettingsSetDelete(t *testing.T) {
+	settings := map[string]interface{}{}
+	settingsSet(settings, "A.b.C", 1)
+	settingsSet(settings, "a.d", 2)
+	want := map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": 1}, "d": 2}}
+	if reflect.DeepEqual(settings, want) == false {
+		t.Errorf("settingsSet() = %v, want %v", settings, want)
+	}
+
+	settingsDelete(settings, "a.b.c")
+	settingsDelete(settings, "x.y")
+	want = map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{}, "d": 2}}
+	if reflect.DeepEqual(settings, want) == false {
+		t.Errorf("settingsDelete() = %v, want %v", settings, want)
+	}
+}
@@ -0,0 +1,218 @@
+package base
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	DefaultRegister("log.redact.enabled", true, "Mask sensitive fields and values in logs")
+	DefaultRegister("log.redact.replacement", secretMask, "Replacement of sensitive values")
+	DefaultRegister("log.redact.fields", []string{
+		"*password*", "*passwd*", "*secret*", "*token*", "*api_key*", "*apikey*", "*private_key*",
+		"authorization", "proxy-authorization", "cookie", "set-cookie",
+	}, "Names of fields to mask, case insensitive, `*` matches any characters")
+	DefaultRegister("log.redact.patterns", []string{
+		// Credentials of Authorization header
+		`(?i)\b(?:bearer|basic|digest)\s+(?P<value>[A-Za-z0-9\-._~+/]+=*)`,
+		// Sensitive keys in query, JSON, headers and dumps of struct
+		`(?i)(?:password|passwd|secret|token|api_?key|authorization|cookie)["']?\s*[:=]\s*["'\[]?(?P<value>[^\s"',;&\[\]{}]+)`,
+		// JSON Web Token
+		`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+		// Email
+		`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	}, "Regular expressions of values to mask in messages and fields, only group `value` is masked if present")
+}
+
+// redactor masks sensitive fields and values of entries before formatting
+type redactor struct {
+	enabled     bool
+	replacement string
+	fields      []string
+	patterns    []*regexp.Regexp
+	mtx         sync.RWMutex
+}
+
+// setup set config of redaction, bad patterns are skipped
+func (r *redactor) setup(enabled bool, replacement string, fields, patterns []string) error {
+	var errs []string
+	var regexps []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		regexps = append(regexps, re)
+	}
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, strings.ToLower(field))
+	}
+
+	r.mtx.Lock()
+	r.enabled, r.replacement, r.fields, r.patterns = enabled, replacement, names, regexps
+	r.mtx.Unlock()
+
+	if 0 < len(errs) {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// redact mask sensitive fields and values of entry, values must be strings
+func (r *redactor) redact(entry *logrus.Entry) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if r.enabled == false {
+		return
+	}
+
+	for key, value := range entry.Data {
+		s, _ := value.(string)
+		if r.field(key) == true {
+			if s != "" {
+				entry.Data[key] = r.replacement
+			}
+			continue
+		}
+		entry.Data[key], _ = r.value(s)
+	}
+	entry.Message, _ = r.value(entry.Message)
+}
+
+// field return whether field is sensitive by name
+func (r *redactor) field(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range r.fields {
+		if ok, _ := path.Match(pattern, name); ok == true {
+			return true
+		}
+	}
+	return false
+}
+
+// value return s with values matched by patterns masked, and whether any
+// value is masked, values already masked are kept
+func (r *redactor) value(s string) (string, bool) {
+	masked := false
+	for _, re := range r.patterns {
+		group := re.SubexpIndex("value")
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			start, end := 0, len(match)
+			if 0 <= group {
+				loc := re.FindStringSubmatchIndex(match)
+				if loc == nil || loc[2*group] < 0 {
+					return match
+				}
+				start, end = loc[2*group], loc[2*group+1]
+			}
+			if match[start:end] == r.replacement {
+				return match
+			}
+			masked = true
+			return match[:start] + r.replacement + match[end:]
+		})
+	}
+	return s, masked
+}
+
+// LogCapture captures entries as they are emitted to outputs, after redaction
+//
+// It is used to assert nothing sensitive is emitted, e.g. in tests:
+//
+//	capture, err := base.NewLogCapture()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer capture.Close()
+//	// ... code that logs
+//	if leaked := capture.Leaked("hunter2"); len(leaked) != 0 {
+//		t.Errorf("leaked in logs: %v", leaked)
+//	}
+type LogCapture struct {
+	key     string
+	lines   []string
+	mtx     sync.Mutex
+	encoder logrus.TextFormatter
+}
+
+// NewLogCapture return a LogCapture, entries are captured until it is closed
+//
+// Logger must be enabled by Init, otherwise entries are neither redacted nor
+// captured, and an error is returned.
+func NewLogCapture() (*LogCapture, error) {
+	initTrigger()
+	if loggerInstance.enabled == false {
+		return nil, fmt.Errorf("Logger is not enabled, entries can't be captured")
+	}
+	c := &LogCapture{encoder: logrus.TextFormatter{DisableColors: true, DisableTimestamp: true}}
+	c.key = fmt.Sprintf("log/capture/%p", c)
+	LogHookRegister(c, c.key)
+	return c, nil
+}
+
+// Logrus Hook / Levels
+func (c *LogCapture) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Logrus Hook / Fire
+func (c *LogCapture) Fire(entry *logrus.Entry) error {
+	line, err := c.encoder.Format(entry)
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	c.lines = append(c.lines, string(line))
+	c.mtx.Unlock()
+	return nil
+}
+
+// Lines return entries captured in text format
+func (c *LogCapture) Lines() []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]string{}, c.lines...)
+}
+
+// Leaked return entries captured which contain any of values, and entries
+// which still match patterns of `log.redact.patterns`
+func (c *LogCapture) Leaked(values ...string) []string {
+	var leaked []string
+	for _, line := range c.Lines() {
+		if redactLeaked(line, values) == true {
+			leaked = append(leaked, line)
+		}
+	}
+	return leaked
+}
+
+// Close stop capturing
+func (c *LogCapture) Close() {
+	LogHookCancel(c.key)
+}
+
+// redactLeaked return whether line contains any of values, or matches patterns
+// of redaction, masked values are not regarded as leaked
+func redactLeaked(line string, values []string) bool {
+	for _, value := range values {
+		if value != "" && strings.Contains(line, value) == true {
+			return true
+		}
+	}
+
+	r := loggerInstance.redact
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if r.enabled == false {
+		return false
+	}
+	_, masked := r.value(line)
+	return masked
+}
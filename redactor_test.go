@@ -0,0 +1,84 @@
+package base
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func TestRedactorValue(t *testing.T) {
+	testInit(t)
+	r := &redactor{}
+	if err := r.setup(true, secretMask, nil, viper.GetStringSlice("log.redact.patterns")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		in, out string
+		masked  bool
+	}{
+		{"Authorization: Bearer abc.def-123", "Authorization: ****** ******", true},
+		{"map[Authorization:[Basic dXNlcjpwYXNz]]", "map[Authorization:[****** ******]]", true},
+		{"?user=bob&token=t0k3n&page=1", "?user=bob&token=******&page=1", true},
+		{`{"password":"hunter2","name":"x"}`, `{"password":"******","name":"x"}`, true},
+		{"{User:bob Password:hunter2}", "{User:bob Password:******}", true},
+		{"jwt eyJhbGciOi.eyJzdWIi.sig", "jwt ******", true},
+		{"mail to bob@example.com", "mail to ******", true},
+		{"password=****** already", "password=****** already", false},
+		{"nothing sensitive", "nothing sensitive", false},
+	}
+	for _, c := range cases {
+		out, masked := r.value(c.in)
+		if out != c.out || masked != c.masked {
+			t.Errorf("value(%q) = %q, %v, want %q, %v", c.in, out, masked, c.out, c.masked)
+		}
+	}
+}
+
+func TestRedactorField(t *testing.T) {
+	r := &redactor{}
+	r.setup(true, secretMask, []string{"*password*", "authorization"}, nil)
+	for name, want := range map[string]bool{
+		"password":      true,
+		"DB_Password":   true,
+		"Authorization": true,
+		"user":          false,
+	} {
+		if got := r.field(name); got != want {
+			t.Errorf("field(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestLogCapture(t *testing.T) {
+	testInit(t)
+	capture, err := NewLogCapture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer capture.Close()
+
+	header := http.Header{"Authorization": []string{"Bearer abc.def-123"}}
+	logrus.WithFields(logrus.Fields{"password": "hunter2", "headers": header}).Error("token=hunter2")
+	logrus.WithField("content", `{"api_key":"k3y"}`).Warn("login of bob@example.com")
+
+	lines := capture.Lines()
+	if len(lines) != 2 {
+		t.Fatalf("captured %d lines, want 2: %v", len(lines), lines)
+	}
+	if leaked := capture.Leaked("hunter2", "abc.def-123", "k3y"); len(leaked) != 0 {
+		t.Errorf("leaked in logs: %v", leaked)
+	}
+	if strings.Contains(lines[1], "bob@example.com") == true {
+		t.Errorf("email is not masked: %v", lines[1])
+	}
+
+	// Values unknown to patterns are found by Leaked
+	logrus.Warn("plain hunter2")
+	if leaked := capture.Leaked("hunter2"); len(leaked) != 1 {
+		t.Errorf("leaked %v, want the plain one", leaked)
+	}
+}
@@ -0,0 +1,300 @@
+// Package remote provide config from remote by http client
+//
+// Content is fetched by client that named `remote_config.<name>.client` in
+// config file, `remote_config_<name>` by default, and merged over config
+// files. Config of remote:
+//
+//	remote_config:
+//	  <name>:
+//	    client:   name of http client
+//	    path:     path of request, default path of client if empty
+//	    format:   yaml or json, guessed by Content-Type or path if empty
+//	    interval: interval of polling, 1m by default
+//	    cache:    file to cache the last good content, under log.dir by default
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/miinowy/go-base"
+	"github.com/miinowy/go-base/client"
+)
+
+var (
+	mtx       sync.Mutex
+	remoteMap sync.Map
+
+	// ErrArgument indicates a argument error
+	ErrArgument = fmt.Errorf("remote: unexcept argument")
+	// ErrConfigure indicates a config error
+	ErrConfigure = fmt.Errorf("remote: unexcept configure")
+)
+
+func init() {
+	base.DefaultRegister("remote_config.<name>.client", "", "Name of http client, remote_config_<name> if empty")
+	base.DefaultRegister("remote_config.<name>.path", "", "Path of request, default path of client if empty")
+	base.DefaultRegister("remote_config.<name>.format", "", "Format of content, yaml or json, guessed if empty")
+	base.DefaultRegister("remote_config.<name>.interval", "1m", "Interval of polling")
+	base.DefaultRegister("remote_config.<name>.cache", "", "File to cache the last good content, under log.dir if empty")
+}
+
+// Context of remote config
+type Context struct {
+	*base.TaskBase
+
+	name   string
+	path   string
+	format string
+	cache  string
+	client *client.Context
+
+	// content of the last good config, and its etag
+	mtx     sync.Mutex
+	etag    string
+	typ     string
+	content []byte
+
+	// content being checked by reload, it takes effect only if accepted
+	staged *remoteContent
+}
+
+// remoteContent is content fetched from remote or restored from cache
+type remoteContent struct {
+	etag    string
+	typ     string
+	content []byte
+	cached  bool
+}
+
+// NewContext return a new Context of remote config, content is fetched and
+// merged before return
+//
+// It must not be called in functions executed when reload
+func NewContext(name string) *Context {
+	if name == "" {
+		return nil
+	}
+
+	// Cache
+	if value, ok := remoteMap.Load(name); ok == true {
+		return value.(*Context)
+	}
+
+	// Double cache
+	mtx.Lock()
+	defer mtx.Unlock()
+	if value, ok := remoteMap.Load(name); ok == true {
+		return value.(*Context)
+	}
+
+	c := &Context{name: name}
+	remoteMap.Store(name, c)
+	base.ProviderRegister(c, c.key())
+	if task, err := base.NewTaskOnInterval(c, c.key(), time.Minute); err == nil {
+		task.Subscribe(fmt.Sprintf("remote_config.%s", name), "log.dir", "base_dir")
+	}
+
+	return c
+}
+
+// key of provider and task
+func (c *Context) key() string {
+	return fmt.Sprintf("remote_config/%s", c.name)
+}
+
+// Config return the last good content, or the content being checked by
+// reload, implements base.ConfigProvider
+func (c *Context) Config() ([]byte, string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.staged != nil {
+		return c.staged.content, c.staged.typ, nil
+	}
+	return c.content, c.typ, nil
+}
+
+// Reload to get lastest config by config file
+func (c *Context) Reload(ctx context.Context) error {
+	if c.name == "" {
+		return ErrArgument
+	}
+
+	prefix := fmt.Sprintf("remote_config.%s.", c.name)
+	name := viper.GetString(prefix + "client")
+	if name == "" {
+		name = fmt.Sprintf("remote_config_%s", c.name)
+	}
+	cli := client.NewContext(name)
+	if cli == nil {
+		return ErrConfigure
+	}
+
+	interval := time.Minute
+	if du, err := time.ParseDuration(viper.GetString(prefix + "interval")); err == nil && 0 < du {
+		interval = du
+	}
+
+	cache := viper.GetString(prefix + "cache")
+	if cache == "" {
+		cache = filepath.Join(viper.GetString("log.dir"), fmt.Sprintf("%s.remote.%s", base.GetAppName(), c.name))
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.client = cli
+	c.path = viper.GetString(prefix + "path")
+	c.format = viper.GetString(prefix + "format")
+	c.cache = base.GetPath(cache)
+	c.SetInterval(interval)
+
+	return nil
+}
+
+// Retire was execute when exit
+func (c *Context) Retire(ctx context.Context) error {
+	base.ProviderCancel(c.key())
+	return nil
+}
+
+// Schedule fetch content and reload if it changed, content, etag and cache
+// are kept only if new config was accepted
+func (c *Context) Schedule(ctx context.Context) error {
+	staged, err := c.fetch(ctx)
+	if err != nil {
+		c.Log.WithError(err).Warn("Failed to fetch remote config")
+		if staged, err = c.restore(); err != nil {
+			c.Log.WithError(err).Warn("Failed to restore remote config from cache")
+			return err
+		}
+	}
+	if staged == nil {
+		return nil
+	}
+
+	c.Log.Debug("Remote config has changed, reload")
+	c.mtx.Lock()
+	c.staged = staged
+	c.mtx.Unlock()
+	err = base.Reload()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.staged = nil
+	if err != nil {
+		c.Log.WithError(err).Warn("Remote config was rejected, keep the previous one")
+		return err
+	}
+	c.etag, c.typ, c.content = staged.etag, staged.typ, staged.content
+	if staged.cached == true {
+		c.Log.WithFields(map[string]interface{}{"cache": c.cache}).Info("Remote config restored from cache")
+	} else if err := c.save(); err != nil {
+		c.Log.WithError(err).Warn("Failed to cache remote config")
+	}
+	return nil
+}
+
+// fetch content from remote, return it if changed
+func (c *Context) fetch(ctx context.Context) (*remoteContent, error) {
+	c.mtx.Lock()
+	cli, path, format, etag := c.client, c.path, c.format, c.etag
+	c.mtx.Unlock()
+
+	if path == "" {
+		path = cli.Path()
+	}
+	request := cli.R().SetContext(ctx)
+	request.Header = cli.Header()
+	if etag != "" {
+		request.SetHeader("If-None-Match", etag)
+	}
+
+	response, err := request.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode() {
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("unexcept status: %v", response.Status())
+	}
+
+	typ := format
+	if typ == "" {
+		typ = c.guess(response.Header().Get("Content-Type"), path)
+	}
+	content := response.Body()
+
+	// Parse content before taking it
+	v := viper.New()
+	v.SetConfigType(typ)
+	if err := v.ReadConfig(bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("Failed to parse remote config: %v", err)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	etag = response.Header().Get("ETag")
+	if c.typ == typ && bytes.Equal(c.content, content) == true {
+		// Same as the last good one
+		c.etag = etag
+		return nil, nil
+	}
+	return &remoteContent{etag: etag, typ: typ, content: content}, nil
+}
+
+// guess format of content by Content-Type or path
+func (c *Context) guess(contentType string, path string) string {
+	switch {
+	case strings.Contains(contentType, "json"):
+		return "json"
+	case strings.Contains(contentType, "yaml"):
+		return "yaml"
+	case strings.Contains(contentType, "toml"):
+		return "toml"
+	}
+	if ext := strings.TrimPrefix(filepath.Ext(path), "."); ext != "" {
+		return ext
+	}
+	return "yaml"
+}
+
+// save content to cache file atomically, type is the first line
+func (c *Context) save() error {
+	tmp := c.cache + ".tmp"
+	if err := ioutil.WriteFile(tmp, append([]byte(c.typ+"\n"), c.content...), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.cache)
+}
+
+// restore content from cache file if no content yet
+func (c *Context) restore() (*remoteContent, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.content != nil {
+		return nil, nil
+	}
+
+	buf, err := ioutil.ReadFile(c.cache)
+	if err != nil {
+		return nil, err
+	}
+	i := strings.Index(string(buf), "\n")
+	if i < 0 {
+		return nil, fmt.Errorf("bad cache file: %v", c.cache)
+	}
+	return &remoteContent{typ: string(buf[:i]), content: buf[i+1:], cached: true}, nil
+}
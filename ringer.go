@@ -0,0 +1,209 @@
+package base
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	DefaultRegister("log.ring.size", 1000, "Number of recent log entries kept in memory, 0 to disable")
+	DefaultRegister("log.ring.all_levels", false, "Keep entries of all levels in memory, regardless of log levels")
+	DefaultRegister("log.ring.dump", "", "File to dump recent log entries, <app>.recent.log under log.dir if empty")
+}
+
+// LogEntry is a recent log entry kept in memory
+type LogEntry struct {
+	Time    time.Time
+	Level   logrus.Level
+	Context string
+	Message string
+	Data    logrus.Fields
+}
+
+// LogQuery is used to filter recent log entries, zero values match all
+type LogQuery struct {
+	// Level is the most verbose level, such as "info"
+	Level string
+	// Context is a pattern as same as keys of `log.levels`
+	Context string
+	// Since and Until limit time of entries
+	Since time.Time
+	Until time.Time
+	// Limit is max number of the latest entries
+	Limit int
+}
+
+// ringer is a ring buffer of recent log entries
+type ringer struct {
+	entries []LogEntry
+	next    int
+	full    bool
+	all     bool
+	mtx     sync.Mutex
+}
+
+// setup resize buffer, the latest entries are kept
+func (r *ringer) setup(size int, all bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.all = all && 0 < size
+	if size < 0 {
+		size = 0
+	}
+	if size == len(r.entries) {
+		return
+	}
+	entries := r.list()
+	if size < len(entries) {
+		entries = entries[len(entries)-size:]
+	}
+	r.entries = make([]LogEntry, size)
+	r.next = copy(r.entries, entries)
+	r.full = r.next == size
+	if r.full == true {
+		r.next = 0
+	}
+}
+
+// keepsAll return whether entries of all levels are kept
+func (r *ringer) keepsAll() bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.all
+}
+
+// add entry into buffer, the oldest one is replaced if full, entry disabled
+// by log levels is added only if all levels are kept
+func (r *ringer) add(entry *logrus.Entry, enabled bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if len(r.entries) == 0 || (enabled == false && r.all == false) {
+		return
+	}
+
+	data := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		data[key] = value
+	}
+	context, _ := entry.Data["context"].(string)
+	r.entries[r.next] = LogEntry{
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Context: context,
+		Message: entry.Message,
+		Data:    data,
+	}
+	r.next++
+	if r.next == len(r.entries) {
+		r.next, r.full = 0, true
+	}
+}
+
+// list return entries from the oldest, mtx must be held
+func (r *ringer) list() []LogEntry {
+	if r.full == false {
+		return append([]LogEntry{}, r.entries[:r.next]...)
+	}
+	return append(append([]LogEntry{}, r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// query return entries matched from the oldest
+func (r *ringer) query(query LogQuery) ([]LogEntry, error) {
+	level := logrus.TraceLevel
+	if query.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(query.Level); err != nil {
+			return nil, err
+		}
+	}
+	pattern := strings.ToLower(query.Context)
+
+	r.mtx.Lock()
+	entries := r.list()
+	r.mtx.Unlock()
+
+	matched := entries[:0]
+	for _, entry := range entries {
+		if level < entry.Level ||
+			(pattern != "" && loggerLevelMatch(pattern, strings.ToLower(entry.Context)) == false) ||
+			(query.Since.IsZero() == false && entry.Time.Before(query.Since)) ||
+			(query.Until.IsZero() == false && entry.Time.After(query.Until)) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	if 0 < query.Limit && query.Limit < len(matched) {
+		matched = matched[len(matched)-query.Limit:]
+	}
+	return matched, nil
+}
+
+// dump entries into file atomically, return path of file
+func (r *ringer) dump(file string) (string, error) {
+	if file == "" {
+		file = viper.GetString("log.ring.dump")
+	}
+	if file == "" {
+		file = fmt.Sprintf("%s.recent.log", GetAppName())
+		file = GetPath(viper.GetString("log.dir"), file)
+	} else {
+		file = GetPath(file)
+	}
+
+	entries, _ := r.query(LogQuery{})
+	formatter := &logrus.TextFormatter{DisableColors: true, FullTimestamp: true, TimestampFormat: time.RFC3339Nano}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		line, err := formatter.Format(&logrus.Entry{Time: e.Time, Level: e.Level, Message: e.Message, Data: e.Data})
+		if err != nil {
+			continue
+		}
+		buf.Write(line)
+	}
+	return file, writeFileAtomic(file, buf.Bytes(), 0644)
+}
+
+// GetRecentLogs return recent log entries matched from the oldest
+//
+// Entries are kept if `log.ring.size` is not 0, entries disabled by log
+// levels are kept only if `log.ring.all_levels` is true.
+func GetRecentLogs(query LogQuery) ([]LogEntry, error) {
+	initTrigger()
+	if loggerInstance.enabled == false {
+		return nil, fmt.Errorf("Logger is not enabled")
+	}
+	return loggerInstance.ring.query(query)
+}
+
+// DumpRecentLogs write recent log entries into file, `log.ring.dump` if file
+// is empty, return path of file
+//
+// Recent logs are dumped automatically if Retire with a non-zero code.
+func DumpRecentLogs(file string) (string, error) {
+	initTrigger()
+	if loggerInstance.enabled == false {
+		return "", fmt.Errorf("Logger is not enabled")
+	}
+	return loggerInstance.ring.dump(file)
+}
+
+// ringDump dump recent logs and log the result, used by Retire
+func ringDump() {
+	if loggerInstance == nil || loggerInstance.enabled == false {
+		return
+	}
+	file, err := loggerInstance.ring.dump("")
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to dump recent logs")
+		return
+	}
+	logrus.WithFields(logrus.Fields{"file": file}).Info("Recent logs dumped")
+}
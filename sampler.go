@@ -0,0 +1,119 @@
+package base
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	DefaultRegister("log.sampling.enabled", false, "Limit repeated log messages by level, message and caller")
+	DefaultRegister("log.sampling.interval", "1s", "Interval of sampling, suppressed messages are summarized at the end of it")
+	DefaultRegister("log.sampling.first", 100, "Number of repeated messages to pass in each interval")
+	DefaultRegister("log.sampling.thereafter", 0, "Pass every Nth repeated messages after the first ones, 0 to suppress all")
+}
+
+// samplerKey identifies repeated messages
+type samplerKey struct {
+	level   logrus.Level
+	message string
+	caller  string
+}
+
+// sampler is used to limit repeated log messages in each interval
+type sampler struct {
+	*TaskBase
+
+	enabled    bool
+	first      int
+	thereafter int
+
+	counts     map[samplerKey]*samplerCount
+	suppressed int
+	mtx        sync.Mutex
+}
+
+// samplerCount is count of messages in current interval
+type samplerCount struct {
+	passed     int
+	suppressed int
+}
+
+func (s *sampler) Reload(ctx context.Context) error {
+	interval := time.Second
+	if du, err := time.ParseDuration(viper.GetString("log.sampling.interval")); err == nil && 0 < du {
+		interval = du
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.enabled = viper.GetBool("log.sampling.enabled")
+	s.first = viper.GetInt("log.sampling.first")
+	s.thereafter = viper.GetInt("log.sampling.thereafter")
+	s.SetInterval(interval)
+	return nil
+}
+
+func (s *sampler) Retire(ctx context.Context) error {
+	return s.Schedule(ctx)
+}
+
+// Schedule summarize suppressed messages and start a new interval
+func (s *sampler) Schedule(ctx context.Context) error {
+	s.mtx.Lock()
+	counts, suppressed := s.counts, s.suppressed
+	s.counts, s.suppressed = nil, 0
+	s.mtx.Unlock()
+
+	if suppressed == 0 {
+		return nil
+	}
+	for key, count := range counts {
+		if count.suppressed == 0 {
+			continue
+		}
+		// Caller of summary is the one of suppressed messages
+		s.Log.WithFields(map[string]interface{}{
+			"src":        key.caller,
+			"suppressed": count.suppressed,
+			"loglevel":   key.level,
+			"message":    key.message,
+		}).Warnf("Suppressed %d similar messages", count.suppressed)
+	}
+	return nil
+}
+
+// sample return whether entry should be passed
+func (s *sampler) sample(entry *logrus.Entry, caller string) bool {
+	// Fatal and panic are never suppressed, nor summaries
+	if entry.Level <= logrus.FatalLevel || entry.Data["context"] == s.Log.Data["context"] {
+		return true
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.enabled == false {
+		return true
+	}
+	if s.counts == nil {
+		s.counts = map[samplerKey]*samplerCount{}
+	}
+	key := samplerKey{level: entry.Level, message: entry.Message, caller: caller}
+	count, ok := s.counts[key]
+	if ok == false {
+		count = &samplerCount{}
+		s.counts[key] = count
+	}
+
+	n := count.passed + count.suppressed
+	if n < s.first || (0 < s.thereafter && (n-s.first+1)%s.thereafter == 0) {
+		count.passed++
+		return true
+	}
+	count.suppressed++
+	s.suppressed++
+	return false
+}
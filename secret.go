@@ -0,0 +1,203 @@
+package base
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// SecretResolver resolve reference of secret to its value
+type SecretResolver interface {
+	// Resolve return value of reference, without scheme prefix
+	Resolve(ref string) (string, error)
+}
+
+// SecretResolverFunc is an adapter to use function as SecretResolver
+type SecretResolverFunc func(ref string) (string, error)
+
+// Resolve call f(ref)
+func (f SecretResolverFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// secretMask replaces secrets in logs and config dumps
+const secretMask = "******"
+
+// secretMinLen is min length of secret to redact, shorter ones are too common
+const secretMinLen = 4
+
+// secretPattern matches references of secrets in form of `${<scheme>:<ref>}`
+var secretPattern = regexp.MustCompile(`\$\{([A-Za-z][A-Za-z0-9+.-]*):([^{}]*)\}`)
+
+var (
+	// Resolvers by scheme
+	secretResolvers sync.Map
+
+	// Values of resolved secrets, sorted by length desc
+	secretValues []string
+	secretMtx    sync.RWMutex
+)
+
+func init() {
+	SecretRegister("env", SecretResolverFunc(func(ref string) (string, error) {
+		value, ok := os.LookupEnv(ref)
+		if ok == false {
+			return "", fmt.Errorf("environment variable %v is not set", ref)
+		}
+		return value, nil
+	}))
+	SecretRegister("file", SecretResolverFunc(func(ref string) (string, error) {
+		buf, err := ioutil.ReadFile(GetPath(ref))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(buf), "\r\n"), nil
+	}))
+}
+
+// SecretRegister is used to register a resolver of secret reference by scheme
+//
+// References in form of `${<scheme>:<ref>}` in config values are resolved on
+// load and reload, e.g. `${env:API_TOKEN}` and `${file:/run/secrets/token}`
+// are supported by default, and `postgres://app:${env:DB_PASSWORD}@db/app`
+// resolves the password only. References of unknown schemes are kept as is.
+// Resolved values are redacted in logs and config dumps.
+func SecretRegister(scheme string, resolver SecretResolver) {
+	secretResolvers.Store(scheme, resolver)
+}
+
+// SecretCancel is used to cancel a resolver of secret reference
+func SecretCancel(scheme string) {
+	secretResolvers.Delete(scheme)
+}
+
+// Redact return s with values of secrets masked
+func Redact(s string) string {
+	secretMtx.RLock()
+	defer secretMtx.RUnlock()
+	for _, secret := range secretValues {
+		s = strings.Replace(s, secret, secretMask, -1)
+	}
+	return s
+}
+
+// GetConfigDump return all settings of config, with secrets masked
+func GetConfigDump() map[string]interface{} {
+	initTrigger()
+	return secretRedactValue(viper.AllSettings()).(map[string]interface{})
+}
+
+// secretRedactValue return a copy of value with secrets masked
+func secretRedactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return Redact(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[key] = secretRedactValue(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = secretRedactValue(val)
+		}
+		return l
+	case []string:
+		l := make([]string, len(v))
+		for i, val := range v {
+			l[i] = Redact(val)
+		}
+		return l
+	}
+	return value
+}
+
+// secretResolve return a copy of settings which contains resolved secrets only
+func secretResolve(settings map[string]interface{}) (map[string]interface{}, []string, error) {
+	var values []string
+	var walk func(value interface{}, key string) (interface{}, bool, error)
+	walk = func(value interface{}, key string) (interface{}, bool, error) {
+		switch v := value.(type) {
+		case string:
+			var changed bool
+			var failed error
+			resolved := secretPattern.ReplaceAllStringFunc(v, func(match string) string {
+				parts := secretPattern.FindStringSubmatch(match)
+				resolver, ok := secretResolvers.Load(parts[1])
+				if ok == false || failed != nil {
+					return match
+				}
+				secret, err := resolver.(SecretResolver).Resolve(parts[2])
+				if err != nil {
+					failed = fmt.Errorf("Failed to resolve secret of %v: %v", key, err)
+					return match
+				}
+				values, changed = append(values, secret), true
+				return secret
+			})
+			if failed != nil {
+				return nil, false, failed
+			}
+			return resolved, changed, nil
+		case []interface{}:
+			var changed bool
+			l := make([]interface{}, len(v))
+			for i, val := range v {
+				x, ok, err := walk(val, fmt.Sprintf("%s[%d]", key, i))
+				if err != nil {
+					return nil, false, err
+				}
+				l[i], changed = x, changed || ok
+			}
+			return l, changed, nil
+		case map[string]interface{}:
+			var changed bool
+			m := map[string]interface{}{}
+			for k, val := range v {
+				x, ok, err := walk(val, strings.TrimPrefix(key+"."+k, "."))
+				if err != nil {
+					return nil, false, err
+				}
+				if ok == true {
+					m[k], changed = x, true
+				}
+			}
+			return m, changed, nil
+		}
+		return value, false, nil
+	}
+
+	resolved, _, err := walk(settings, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolved.(map[string]interface{}), values, nil
+}
+
+// secretStore add values of secrets to be redacted
+func secretStore(values []string) {
+	secretMtx.Lock()
+	defer secretMtx.Unlock()
+
+	known := map[string]bool{}
+	for _, secret := range secretValues {
+		known[secret] = true
+	}
+	for _, secret := range values {
+		if secretMinLen <= len(secret) && known[secret] == false {
+			known[secret] = true
+			secretValues = append(secretValues, secret)
+		}
+	}
+	sort.Slice(secretValues, func(i, j int) bool {
+		return len(secretValues[i]) > len(secretValues[j])
+	})
+}
@@ -0,0 +1,79 @@
+package base
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretResolve(t *testing.T) {
+	t.Setenv("BASETEST_SECRET", "hunter2")
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		value    interface{}
+		resolved interface{}
+		ok       bool
+	}{
+		{"${env:BASETEST_SECRET}", "hunter2", true},
+		{"${file:" + file + "}", "s3cr3t", true},
+		{"pg://app:${env:BASETEST_SECRET}@db/app", "pg://app:hunter2@db/app", true},
+		{[]interface{}{"a", "${env:BASETEST_SECRET}"}, []interface{}{"a", "hunter2"}, true},
+		{"env:BASETEST_SECRET", nil, false},
+		{"file:///etc/hosts", nil, false},
+		{"${unknown:ref}", nil, false},
+		{"$env:BASETEST_SECRET", nil, false},
+	}
+	for _, c := range cases {
+		resolved, _, err := secretResolve(map[string]interface{}{"key": c.value})
+		if err != nil {
+			t.Errorf("secretResolve(%v): %v", c.value, err)
+			continue
+		}
+		value, ok := resolved["key"]
+		if ok != c.ok || reflect.DeepEqual(value, c.resolved) == false {
+			t.Errorf("secretResolve(%v) = %v, %v, want %v, %v", c.value, value, ok, c.resolved, c.ok)
+		}
+	}
+
+	if _, _, err := secretResolve(map[string]interface{}{"key": "${env:BASETEST_UNSET}"}); err == nil {
+		t.Errorf("secretResolve of unset variable got no error")
+	}
+}
+
+func TestEventConfigChangedRedacted(t *testing.T) {
+	testInit(t)
+	t.Setenv("BASETEST_SECRET", "hunter2-redacted")
+
+	events := make(chan Event, 1)
+	EventRegister(func(event Event) {
+		select {
+		case events <- event:
+		default:
+		}
+	}, "test/secret", EventConfigChanged)
+	defer EventCancel("test/secret")
+
+	ProviderRegister(testProvider("test: {secret: '${env:BASETEST_SECRET}'}"), "test/secret")
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	ProviderCancel("test/secret")
+	defer Reload()
+
+	select {
+	case event := <-events:
+		if s := fmt.Sprint(event.Old, event.New); s == "" || strings.Contains(s, "hunter2-redacted") == true {
+			t.Errorf("secret leaked in event: %v", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event of config changed")
+	}
+}
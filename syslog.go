@@ -0,0 +1,378 @@
+package base
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	DefaultRegister("log.syslog.enabled", false, "Write log into syslog in format of RFC5424")
+	DefaultRegister("log.syslog.network", "unixgram", "Network of syslog: unixgram, unix, udp or tcp")
+	DefaultRegister("log.syslog.address", "/dev/log", "Address of syslog")
+	DefaultRegister("log.syslog.facility", "local0", "Facility of syslog, such as user, daemon or local0 to local7")
+	DefaultRegister("log.syslog.tag", "", "App name in syslog, name of app if empty")
+
+	DefaultRegister("log.journald.enabled", false, "Write log into journald by native protocol, fields are kept")
+	DefaultRegister("log.journald.socket", "/run/systemd/journal/socket", "Socket of journald")
+}
+
+// syslogFacilities by name
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSeverity return severity of syslog by level
+func syslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 1
+	case logrus.FatalLevel:
+		return 2
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	}
+	return 7
+}
+
+// syslogRetry is backoff of reconnecting, entries are dropped quietly until
+// the next retry, so that logging won't stall while syslog is down
+type syslogRetry struct {
+	next    time.Time
+	backoff time.Duration
+}
+
+// ready return whether it is time to connect
+func (r *syslogRetry) ready() bool {
+	return time.Now().Before(r.next) == false
+}
+
+// fail delay the next retry by doubled backoff, from a second up to a minute
+func (r *syslogRetry) fail() {
+	r.backoff *= 2
+	if r.backoff < time.Second {
+		r.backoff = time.Second
+	}
+	if time.Minute < r.backoff {
+		r.backoff = time.Minute
+	}
+	r.next = time.Now().Add(r.backoff)
+}
+
+// reset backoff after connected
+func (r *syslogRetry) reset() {
+	r.next, r.backoff = time.Time{}, 0
+}
+
+// syslogger is a hook to write entries into syslog
+type syslogger struct {
+	l *logger
+
+	enabled  bool
+	network  string
+	address  string
+	facility int
+	tag      string
+
+	conn    net.Conn
+	dialing bool
+	retry   syslogRetry
+	mtx     sync.Mutex
+}
+
+// setup set config of syslog, connection is closed if address changed
+func (s *syslogger) setup(enabled bool, network, address, facility, tag string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var err error
+	f, ok := syslogFacilities[strings.ToLower(facility)]
+	if ok == false {
+		err = fmt.Errorf("unknown facility %v", facility)
+		f = syslogFacilities["local0"]
+	}
+	if s.conn != nil && (enabled == false || s.network != network || s.address != address) {
+		s.conn.Close()
+		s.conn = nil
+	}
+	if s.network != network || s.address != address {
+		s.retry.reset()
+	}
+	s.enabled, s.network, s.address, s.facility, s.tag = enabled, network, address, f, tag
+	s.connect()
+	return err
+}
+
+// connect dial syslog in background if it is time to, mtx must be held
+func (s *syslogger) connect() {
+	if s.enabled == false || s.conn != nil || s.dialing == true || s.retry.ready() == false {
+		return
+	}
+	s.dialing = true
+	network, address := s.network, s.address
+	go func() {
+		conn, err := net.DialTimeout(network, address, time.Second)
+
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		s.dialing = false
+
+		// Config changed while dialing
+		if s.enabled == false || s.network != network || s.address != address || s.conn != nil {
+			if err == nil {
+				conn.Close()
+			}
+			s.connect()
+			return
+		}
+		if err != nil {
+			s.retry.fail()
+			s.l.failure.report("syslog", err)
+			return
+		}
+		s.conn = conn
+		s.retry.reset()
+	}()
+}
+
+// Logrus Hook / Levels
+func (s *syslogger) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Logrus Hook / Fire
+func (s *syslogger) Fire(entry *logrus.Entry) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.enabled == false || s.l.passed(entry) == false {
+		return nil
+	}
+
+	// Entries are dropped until connected, connecting never blocks logging
+	if s.conn == nil {
+		s.connect()
+		return nil
+	}
+
+	msg := s.format(entry)
+	if s.network != "unixgram" && s.network != "udp" {
+		msg = append(msg, '\n')
+	}
+	if _, err := s.conn.Write(msg); err != nil {
+		// Entry larger than buffer of socket is dropped, connection is kept
+		if errors.Is(err, syscall.EMSGSIZE) == true || errors.Is(err, syscall.ENOBUFS) == true {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+		s.l.failure.report("syslog", err)
+		s.connect()
+	}
+	return nil
+}
+
+// format entry by RFC5424, fields are kept as structured data
+func (s *syslogger) format(entry *logrus.Entry) []byte {
+	hostname, _ := os.Hostname()
+	msgid, _ := entry.Data["context"].(string)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d %s ",
+		s.facility*8+syslogSeverity(entry.Level),
+		entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeader(hostname, 255),
+		syslogHeader(s.tag, 48),
+		os.Getpid(),
+		syslogHeader(msgid, 32),
+	)
+
+	if len(entry.Data) == 0 {
+		buf.WriteString("-")
+	} else {
+		var keys []string
+		for key := range entry.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		// 32473 is the enterprise number reserved for example
+		buf.WriteString("[fields@32473")
+		for _, key := range keys {
+			value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).
+				Replace(fmt.Sprintf("%v", entry.Data[key]))
+			fmt.Fprintf(&buf, ` %s="%s"`, syslogParamName(key), value)
+		}
+		buf.WriteString("]")
+	}
+	buf.WriteString(" ")
+	buf.WriteString(entry.Message)
+	return buf.Bytes()
+}
+
+// syslogHeader return field of header, printable and limited in length
+func syslogHeader(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || 126 < r {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	if max < len(s) {
+		s = s[:max]
+	}
+	return s
+}
+
+// syslogParamName return name of structured data parameter
+func syslogParamName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || 126 < r || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+	if 32 < len(s) {
+		s = s[:32]
+	}
+	return s
+}
+
+// journaler is a hook to write entries into journald by native protocol
+//
+// Entry larger than buffer of socket is dropped.
+type journaler struct {
+	l *logger
+
+	enabled bool
+	socket  string
+	tag     string
+
+	conn  *net.UnixConn
+	retry syslogRetry
+	mtx   sync.Mutex
+}
+
+// setup set config of journald, connection is closed if socket changed
+func (j *journaler) setup(enabled bool, socket, tag string) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if j.conn != nil && (enabled == false || j.socket != socket) {
+		j.conn.Close()
+		j.conn = nil
+	}
+	if j.socket != socket {
+		j.retry.reset()
+	}
+	j.enabled, j.socket, j.tag = enabled, socket, tag
+}
+
+// Logrus Hook / Levels
+func (j *journaler) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Logrus Hook / Fire
+func (j *journaler) Fire(entry *logrus.Entry) error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	if j.enabled == false || j.l.passed(entry) == false {
+		return nil
+	}
+
+	// Entries are dropped while journald is down
+	if j.conn == nil {
+		if j.retry.ready() == false {
+			return nil
+		}
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: j.socket, Net: "unixgram"})
+		if err != nil {
+			j.retry.fail()
+			j.l.failure.report("journald", err)
+			return nil
+		}
+		j.conn = conn
+	}
+	if _, err := j.conn.Write(j.format(entry)); err != nil {
+		// Entry larger than buffer of socket is dropped, connection is kept
+		if errors.Is(err, syscall.EMSGSIZE) == true || errors.Is(err, syscall.ENOBUFS) == true {
+			return nil
+		}
+		j.conn.Close()
+		j.conn = nil
+		j.retry.fail()
+		j.l.failure.report("journald", err)
+		return nil
+	}
+	j.retry.reset()
+	return nil
+}
+
+// format entry by native protocol of journald, fields are upper cased
+func (j *journaler) format(entry *logrus.Entry) []byte {
+	var buf bytes.Buffer
+	write := func(key, value string) {
+		if strings.Contains(value, "\n") == false {
+			fmt.Fprintf(&buf, "%s=%s\n", key, value)
+			return
+		}
+		// Value with newline is written by its length
+		buf.WriteString(key)
+		buf.WriteByte('\n')
+		binary.Write(&buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+
+	write("MESSAGE", entry.Message)
+	write("PRIORITY", fmt.Sprintf("%d", syslogSeverity(entry.Level)))
+	write("SYSLOG_IDENTIFIER", j.tag)
+	for key, value := range entry.Data {
+		if name := journalFieldName(key); name != "" {
+			write(name, fmt.Sprintf("%v", value))
+		}
+	}
+	return buf.Bytes()
+}
+
+// journalFieldName return field name of journald, empty if it is reserved
+func journalFieldName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+	s = strings.TrimLeft(s, "_0123456789")
+	switch s {
+	case "", "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER":
+		return ""
+	}
+	if 64 < len(s) {
+		s = s[:64]
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package base
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testSyslogWait wait until dialing in background is done, return whether
+// it is connected
+func testSyslogWait(t *testing.T, s *syslogger) bool {
+	for begin := time.Now(); time.Since(begin) < 5*time.Second; time.Sleep(time.Millisecond) {
+		s.mtx.Lock()
+		dialing, connected := s.dialing, s.conn != nil
+		s.mtx.Unlock()
+		if dialing == false {
+			return connected
+		}
+	}
+	t.Fatal("Dialing syslog is not done")
+	return false
+}
+
+func TestSysloggerDown(t *testing.T) {
+	cases := []struct {
+		network, address string
+	}{
+		{"unixgram", filepath.Join(t.TempDir(), "missing.sock")},
+		// Dialing may take until timeout if network is reachable
+		{"tcp", "192.0.2.1:514"},
+	}
+	for _, c := range cases {
+		l := &logger{level: logrus.InfoLevel, failure: loggerFailure{writer: ioutil.Discard}}
+		s := &syslogger{l: l}
+		s.setup(true, c.network, c.address, "local0", "test")
+
+		begin := time.Now()
+		for i := 0; i < 100; i++ {
+			entry := &logrus.Entry{Logger: logrus.StandardLogger(), Data: logrus.Fields{}, Time: time.Now(), Level: logrus.InfoLevel, Message: "hello"}
+			if err := s.Fire(entry); err != nil {
+				t.Fatalf("Fire() = %v, want entries dropped quietly", err)
+			}
+		}
+		if du := time.Since(begin); 100*time.Millisecond < du {
+			t.Errorf("Fire() of %s took %v while syslog is down", c.network, du)
+		}
+		if testSyslogWait(t, s) == true {
+			t.Fatalf("%s: connected to %s", c.network, c.address)
+		}
+		if s.retry.ready() == true {
+			t.Errorf("%s: retry is ready right after failure", c.network)
+		}
+
+		// Backoff is reset if address changed
+		s.setup(false, c.network, c.address+".other", "local0", "test")
+		if s.retry.ready() == false {
+			t.Errorf("%s: retry is not reset after address changed", c.network)
+		}
+	}
+}
+
+func TestSyslogRetry(t *testing.T) {
+	var r syslogRetry
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		r.fail()
+		if r.backoff != want {
+			t.Errorf("backoff = %v, want %v", r.backoff, want)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		r.fail()
+	}
+	if r.backoff != time.Minute {
+		t.Errorf("backoff = %v, want a minute at most", r.backoff)
+	}
+	r.reset()
+	if r.ready() == false || r.backoff != 0 {
+		t.Errorf("retry is not reset")
+	}
+}
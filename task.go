@@ -6,6 +6,7 @@ import (
 	"net"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -38,6 +39,10 @@ type Tasker interface {
 
 // TaskBase must be wrapped in struct which implement Tasker interface by unnamed pointer
 type TaskBase struct {
+	// interval set by SetInterval, read by goroutine of task atomically, keep
+	// it first to be 64-bit aligned
+	interval int64
+
 	taskType taskType
 
 	id   string
@@ -48,7 +53,7 @@ type TaskBase struct {
 	// Trigger's type is according task type
 	//   taskOnTcp:      net.Listener
 	//   taskOnChannel:  Channel
-	//   taskOnInterval: time.Duration
+	//   taskOnInterval: time.Duration, use SetInterval to change it in Reload
 	//   taskOnFsChange: *fsnotify.Watcher
 	Trigger interface{}
 
@@ -102,6 +107,20 @@ func newTaskBase(w *TaskBase, args ...interface{}) *TaskBase {
 	return w
 }
 
+// SetInterval change interval of taskTypeOnInterval, takes effect from next
+// interval, it is safe to be called while task is running
+func (w *TaskBase) SetInterval(interval time.Duration) {
+	atomic.StoreInt64(&w.interval, int64(interval))
+}
+
+// getInterval return interval set by SetInterval, or Trigger if not set
+func (w *TaskBase) getInterval() time.Duration {
+	if interval := atomic.LoadInt64(&w.interval); interval != 0 {
+		return time.Duration(interval)
+	}
+	return w.Trigger.(time.Duration)
+}
+
 // Task context
 type Task struct {
 	Tasker
@@ -118,9 +137,10 @@ type Task struct {
 	life context.Context
 	die  context.CancelFunc
 
-	// nap context is used for trigger
-	nap  context.Context
-	fire context.CancelFunc
+	// nap context is used for trigger, fire is guarded by mtxFire
+	nap     context.Context
+	fire    context.CancelFunc
+	mtxFire sync.Mutex
 
 	// retire context is used for destruct
 	retire  context.Context
@@ -129,6 +149,8 @@ type Task struct {
 
 // newTask initialize *Task
 func newTask(tasker Tasker, taskBase *TaskBase) (*Task, error) {
+	initTrigger()
+
 	t := &Task{Tasker: tasker}
 	tb := t.getTaskBase()
 	*tb = *taskBase
@@ -216,12 +238,34 @@ func (t *Task) Fire() error {
 	tb := t.getTaskBase()
 	if tb.taskType == taskTypeManual {
 		return t.Tasker.Schedule(t.life)
-	} else if t.fire != nil {
-		t.fire()
 	}
+	t.wake()
 	return nil
 }
 
+// setNap set nap context and its cancel function of goroutine
+func (t *Task) setNap(nap context.Context, fire context.CancelFunc) {
+	t.mtxFire.Lock()
+	t.nap, t.fire = nap, fire
+	t.mtxFire.Unlock()
+}
+
+// wake cancel nap context of goroutine if any
+func (t *Task) wake() {
+	t.mtxFire.Lock()
+	fire := t.fire
+	t.mtxFire.Unlock()
+	if fire != nil {
+		fire()
+	}
+}
+
+// Subscribe config key prefixes, task will be reloaded only if any key
+// matched changed, see ReloadSubscribe
+func (t *Task) Subscribe(prefixes ...string) {
+	ReloadSubscribe(t.id, prefixes...)
+}
+
 // Reload is used to reload task
 func (t *Task) Reload() (err error) {
 	t.mtxReload.Lock()
@@ -234,9 +278,7 @@ func (t *Task) Reload() (err error) {
 	if err = t.Tasker.Reload(t.life); err != nil {
 		return err
 	}
-	if t.fire != nil {
-		t.fire()
-	}
+	t.wake()
 
 	tb.Log.WithFields(logrus.Fields{"task": t, "tasker": t.Tasker, "taskBase": tb}).
 		Debug("Task reloaded")
@@ -358,18 +400,18 @@ func (t *Task) routine() {
 		switch tb.taskType {
 		case taskTypeOnInterval:
 			if tb.Sleep == true {
-				t.nap, t.fire = context.WithCancel(context.Background())
+				t.setNap(context.WithCancel(context.Background()))
 				LiverCancel(t.id)
 			} else {
-				t.nap, t.fire = context.WithTimeout(context.Background(), tb.Trigger.(time.Duration))
+				t.setNap(context.WithTimeout(context.Background(), tb.getInterval()))
 				if tb.Argument.(bool) == true {
-					LiverRegister(t.id, tb.Trigger.(time.Duration)*4)
+					LiverRegister(t.id, tb.getInterval()*4)
 				}
 			}
 		case taskTypeOnReload:
-			t.nap, t.fire = context.WithCancel(context.Background())
+			t.setNap(context.WithCancel(context.Background()))
 		case taskTypeManual:
-			t.nap, t.fire = context.WithCancel(context.Background())
+			t.setNap(context.WithCancel(context.Background()))
 		case taskTypeOnTCP:
 			t.nap, cancel = context.WithCancel(context.Background())
 			go func() {
@@ -423,7 +465,7 @@ func (t *Task) routine() {
 		tb.Log.Trace("Task fire")
 		if tb.taskType == taskTypeOnInterval {
 			if tb.Sleep == false {
-				ctx, cancel := context.WithTimeout(t.life, tb.Trigger.(time.Duration))
+				ctx, cancel := context.WithTimeout(t.life, tb.getInterval())
 				defer cancel()
 				t.Tasker.Schedule(ctx)
 			}
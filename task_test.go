@@ -0,0 +1,52 @@
+package base
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testIntervalTasker changes interval on each reload
+type testIntervalTasker struct {
+	*TaskBase
+	reloads   int64
+	schedules int64
+}
+
+func (w *testIntervalTasker) Reload(ctx context.Context) error {
+	n := atomic.AddInt64(&w.reloads, 1)
+	w.SetInterval(time.Millisecond * time.Duration(1+n%3))
+	return nil
+}
+
+func (w *testIntervalTasker) Retire(ctx context.Context) error {
+	return nil
+}
+
+func (w *testIntervalTasker) Schedule(ctx context.Context) error {
+	atomic.AddInt64(&w.schedules, 1)
+	return nil
+}
+
+func TestTaskSetInterval(t *testing.T) {
+	testInit(t)
+
+	w := &testIntervalTasker{}
+	task, err := NewTaskOnInterval(w, "test/interval", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if err := task.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := task.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&w.schedules) == 0 {
+		t.Errorf("task is never scheduled")
+	}
+}
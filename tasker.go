@@ -3,22 +3,16 @@ package base
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
+	"net"
 	"os"
 	"os/signal"
-	"path"
 	"path/filepath"
-	"runtime"
-	"strings"
+	"sort"
 	"sync"
 	"syscall"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
-	"github.com/rifflock/lfshook"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var (
@@ -29,6 +23,7 @@ var (
 	memorInstance *memor
 	memorTaskOnce sync.Once
 
+	conferInstance     *confer
 	conferTaskOnce     sync.Once
 	conferTaskInstance *Task
 
@@ -36,14 +31,27 @@ var (
 	loggerTaskOnce     sync.Once
 	loggerTaskInstance *Task
 
+	samplerInstance *sampler
+	samplerTaskOnce sync.Once
+
 	liverInstance *liver
 	liverTaskOnce sync.Once
+
+	neterInstance *neter
+	neterTaskOnce sync.Once
 )
 
+func init() {
+	DefaultRegister("base_dir", "", "Base directory of relative paths, directory of execute file if empty")
+
+	DefaultRegister("ip.interface", "", "Only pick IP addresses of the network interface by name")
+	DefaultRegister("ip.cidr", []string{}, "Prefer IP addresses in these CIDRs, by order")
+	DefaultRegister("ip.ipv6", false, "Prefer IPv6 addresses to IPv4 addresses")
+	ValidateRegister(neterValidate, "ip")
+}
+
 func inforTrigger() {
-	inforTaskOnce.Do(func() {
-		NewTaskOneTime(&infor{}, "info")
-	})
+	inforTaskOnce.Do(infor)
 }
 
 func sigerTrigger() {
@@ -58,6 +66,7 @@ func memorTrigger() {
 	memorTaskOnce.Do(func() {
 		go func() {
 			<-time.After(5 * time.Second)
+			// Not subscribed, limit of cgroup may change without config
 			memorInstance = &memor{}
 			NewTaskOnInterval(memorInstance, "memor", 20*time.Second)
 		}()
@@ -66,38 +75,48 @@ func memorTrigger() {
 
 func conferTrigger() {
 	conferTaskOnce.Do(func() {
-		conferTaskInstance, _ = NewTaskManual(&confer{}, "config")
+		conferInstance = &confer{}
+		conferTaskInstance, _ = NewTaskManual(conferInstance, "config")
 	})
 }
 
 func loggerTrigger() {
 	loggerTaskOnce.Do(func() {
-		loggerInstance = &logger{}
+		loggerInstance = &logger{ring: &ringer{}, redact: &redactor{}}
 		loggerTaskInstance, _ = NewTaskManual(loggerInstance, "logger")
 	})
 }
 
+func samplerTrigger() {
+	samplerTaskOnce.Do(func() {
+		samplerInstance = &sampler{}
+		if task, err := NewTaskOnInterval(samplerInstance, "log/sampling", time.Second); err == nil {
+			task.Subscribe("log.sampling")
+		}
+	})
+}
+
 func liverTrigger() {
 	liverTaskOnce.Do(func() {
 		liverInstance = &liver{}
-		NewTaskOnInterval(liverInstance, "liver", 10*time.Second, false)
+		if task, err := NewTaskOnInterval(liverInstance, "liver", 10*time.Second, false); err == nil {
+			task.Subscribe("log.dir", "base_dir")
+		}
 	})
 }
 
-// infor is used to initialize information of app
-type infor struct {
-	*TaskBase
-}
-
-func (i *infor) Reload(ctx context.Context) error {
-	return nil
-}
-
-func (i *infor) Retire(ctx context.Context) error {
-	return nil
+func neterTrigger() {
+	neterTaskOnce.Do(func() {
+		// Not subscribed, addresses of interfaces may change without config
+		neterInstance = &neter{}
+		NewTaskOnReload(neterInstance, "net")
+	})
 }
 
-func (i *infor) Schedule(ctx context.Context) error {
+// infor is used to initialize information of app
+//
+// It is executed at importing, so nothing else should be touched here
+func infor() {
 	startAt = time.Now()
 
 	executable, err := os.Executable()
@@ -112,7 +131,8 @@ func (i *infor) Schedule(ctx context.Context) error {
 	}
 	appName = execName
 
-	return nil
+	// Build information
+	buildInfoFill()
 }
 
 // siger is used to watch signal
@@ -144,234 +164,15 @@ func (s *siger) Schedule(ctx context.Context) error {
 		s.Log.WithFields(map[string]interface{}{"content": s}).
 			Debug("Got a reload signal")
 		go Reload()
+	case syscall.SIGUSR2:
+		// Reopen log file after SIGUSR2
+		s.Log.WithFields(map[string]interface{}{"content": s}).
+			Debug("Got a reopen signal")
+		go ReopenLogFile()
 	}
 	return nil
 }
 
-// memor is used to prevent memory leak
-type memor struct {
-	*TaskBase
-
-	limit uint64
-}
-
-func (l *memor) Reload(ctx context.Context) error {
-	l.limit = viper.GetUint64("memory.limit")
-
-	if l.limit == 0 {
-		l.limit = 1024 * 1024 * 1024
-	}
-	if l.limit < 16*1024*1024 {
-		l.limit = 16 * 1024 * 1024
-	}
-
-	return nil
-}
-
-func (l *memor) Retire(ctx context.Context) error {
-	return nil
-}
-
-func (l *memor) Schedule(ctx context.Context) error {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	l.Log.WithFields(map[string]interface{}{"alloc": m.Alloc, "gc": m.NumGC}).
-		Trace("Memory checking")
-
-	if l.limit < m.Alloc {
-		l.Log.WithFields(map[string]interface{}{"alloc": m.Alloc, "gc": m.NumGC}).
-			Warn("Memory over limit")
-
-		Daemon()
-	}
-
-	return nil
-}
-
-// confer is used for initialize config
-type confer struct {
-	*TaskBase
-
-	read bool
-	mtx  sync.Mutex
-}
-
-func (c *confer) Reload(ctx context.Context) error {
-	return nil
-}
-
-func (c *confer) Retire(ctx context.Context) error {
-	return nil
-}
-
-func (c *confer) Schedule(ctx context.Context) error {
-	if c.read == false {
-		return c.init()
-	}
-	return viper.ReadInConfig()
-}
-
-func (c *confer) init() error {
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
-
-	if c.read == true {
-		return viper.ReadInConfig()
-	}
-	c.read = true
-
-	if strings.HasSuffix(GetExecName(), "test") {
-		viper.SetConfigName("test")
-	} else {
-		viper.SetConfigName(GetExecName())
-	}
-	viper.SetConfigType("")
-
-	// Seach directory tree
-	for _, base := range []string{GetExecDir(), GetWorkDir()} {
-		for ; ; base = path.Dir(base) {
-			viper.AddConfigPath(base)
-			viper.AddConfigPath(filepath.Join(base, "etc"))
-			viper.AddConfigPath(filepath.Join(base, "conf"))
-			viper.AddConfigPath(filepath.Join(base, "config"))
-			viper.AddConfigPath(filepath.Join(base, "configs"))
-			if base == path.Dir(base) {
-				break
-			}
-		}
-	}
-
-	// Watch config change
-	viper.WatchConfig()
-	viper.OnConfigChange(func(e fsnotify.Event) {
-		c.Log.Debug("Config file has changed, auto reload")
-		Reload()
-	})
-
-	if err := viper.ReadInConfig(); err != nil {
-		panic(err)
-	}
-	return nil
-}
-
-// logger is used to initialize logger
-type logger struct {
-	*TaskBase
-	lumberjack.Logger
-
-	loglevel logrus.Level
-
-	set bool
-	mtx sync.Mutex
-}
-
-func (l *logger) Reload(ctx context.Context) error {
-	return nil
-}
-
-func (l *logger) Retire(ctx context.Context) error {
-	return nil
-}
-
-func (l *logger) Schedule(ctx context.Context) error {
-	if l.set == false {
-		l.init()
-	} else {
-		l.adjustOutPut()
-		l.adjustLogLevel()
-	}
-	return nil
-}
-
-func (l *logger) init() {
-	l.mtx.Lock()
-	defer l.mtx.Unlock()
-
-	if l.set == true {
-		l.adjustOutPut()
-		l.adjustLogLevel()
-	}
-	l.set = true
-
-	// log format
-	logrus.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp:   true,
-		TimestampFormat: time.RFC3339,
-	})
-
-	// caller
-	logrus.SetReportCaller(true)
-
-	// Register fatal handler
-	logrus.RegisterExitHandler(func() { Retire(1) })
-
-	// Hooks
-	logrus.AddHook(l)
-	logrus.AddHook(lfshook.NewHook(l, &logrus.TextFormatter{
-		TimestampFormat: time.RFC3339,
-		FullTimestamp:   true,
-	}))
-
-	// Output to Stderr
-	if fi, err := os.Stdout.Stat(); err != nil || (fi.Mode()&os.ModeCharDevice == 0) {
-		logrus.SetOutput(ioutil.Discard)
-	} else {
-		logrus.SetOutput(os.Stderr)
-	}
-}
-
-func (l *logger) adjustLogLevel() {
-	if level, err := logrus.ParseLevel(viper.GetString("log.level")); err != nil {
-		l.loglevel = logrus.InfoLevel
-	} else {
-		l.loglevel = level
-	}
-
-	if strings.HasSuffix(GetExecName(), "test") == false && IsLiteMode() == true && logrus.InfoLevel < l.loglevel {
-		logrus.SetLevel(logrus.InfoLevel)
-	} else {
-		logrus.SetLevel(l.loglevel)
-	}
-}
-
-func (l *logger) adjustOutPut() {
-	l.Filename = GetPath(viper.GetString("log.dir"), fmt.Sprintf("%s.log", GetAppName()))
-	l.MaxAge = viper.GetInt("log.maxage")
-	l.MaxSize = viper.GetInt("log.maxsize")
-	l.MaxBackups = viper.GetInt("log.maxbackups")
-	l.Compress = viper.GetBool("log.compress")
-}
-
-// Logrus Hook / Levels
-func (l *logger) Levels() []logrus.Level {
-	return logrus.AllLevels
-}
-
-// Logrus Hook / Fire
-func (l *logger) Fire(entry *logrus.Entry) error {
-	// Make caller simpler by cut string
-	if entry.Caller != nil {
-		if src, ok := entry.Data["src"]; ok == true {
-			entry.Data["caller"] = src
-		} else {
-			entry.Data["caller"] = fmt.Sprintf(
-				"%v:%v",
-				entry.Caller.File[strings.Index(entry.Caller.File, GetBuildDir())+len(GetBuildDir())+1:],
-				entry.Caller.Line,
-			)
-		}
-		entry.Caller = nil
-	}
-
-	// Make values clearer by `printf("%+v")`
-	for key, value := range entry.Data {
-		entry.Data[key] = fmt.Sprintf("%+v", value)
-	}
-
-	return nil
-}
-
 // live indicates a live instance
 type live struct {
 	last    time.Time
@@ -403,6 +204,7 @@ func (l *liver) Schedule(ctx context.Context) error {
 	l.data.Range(func(key, value interface{}) bool {
 		lc := value.(*live)
 		if lc != nil && lc.timeout < now.Sub(lc.last) {
+			eventEmit(Event{Type: EventLiverDeath, Key: fmt.Sprintf("%v", key)})
 			go l.Log.WithFields(map[string]interface{}{"key": key, "content": lc}).
 				Fatal("A live context was died")
 			return false
@@ -445,3 +247,140 @@ func (l *liver) aliveTouch(ctx context.Context) {
 		os.Chtimes(l.path, currentTime, currentTime)
 	}
 }
+
+// neter is used to pick IP addresses of host by network interfaces
+//
+// Config keys:
+//
+//	ip.interface: only pick addresses of the interface by name
+//	ip.cidr:      prefer addresses in these CIDRs, by order
+//	ip.ipv6:      prefer IPv6 addresses to IPv4 addresses
+type neter struct {
+	*TaskBase
+
+	ips []net.IP
+	mtx sync.Mutex
+}
+
+func (n *neter) Reload(ctx context.Context) error {
+	ips, err := n.candidates(
+		viper.GetString("ip.interface"),
+		viper.GetStringSlice("ip.cidr"),
+		viper.GetBool("ip.ipv6"),
+	)
+	if err != nil {
+		// Keep the previous addresses, it is not fatal
+		n.Log.WithError(err).Warn("Failed to refresh host IP addresses")
+		return nil
+	}
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.ips = ips
+	n.Log.WithFields(map[string]interface{}{"ips": ips}).Debug("Host IP addresses refreshed")
+	return nil
+}
+
+func (n *neter) Retire(ctx context.Context) error {
+	return nil
+}
+
+func (n *neter) Schedule(ctx context.Context) error {
+	return nil
+}
+
+// neterValidate check CIDRs of ip.cidr
+func neterValidate(v *viper.Viper) error {
+	for _, cidr := range v.GetStringSlice("ip.cidr") {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("Invalid ip.cidr %v: %v", cidr, err)
+		}
+	}
+	return nil
+}
+
+// IPs return a copy of candidate addresses
+func (n *neter) IPs() []net.IP {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return append([]net.IP{}, n.ips...)
+}
+
+// candidates return addresses of interfaces, sorted by preference
+func (n *neter) candidates(name string, cidrs []string, ipv6 bool) ([]net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []neterAddr
+	for _, iface := range ifaces {
+		ifaddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaddrs {
+			if ipnet, ok := addr.(*net.IPNet); ok == true {
+				addrs = append(addrs, neterAddr{iface: iface.Name, flags: iface.Flags, ip: ipnet.IP})
+			}
+		}
+	}
+	return neterRank(addrs, name, cidrs, ipv6), nil
+}
+
+// neterAddr is an address of interface
+type neterAddr struct {
+	iface string
+	flags net.Flags
+	ip    net.IP
+}
+
+// neterRank return global unicast addresses of interfaces which are up and
+// not loopback, filtered by name of interface if not empty, sorted by order
+// of CIDRs they are in, then by IP version preferred
+func neterRank(addrs []neterAddr, name string, cidrs []string, ipv6 bool) []net.IP {
+	// Invalid CIDRs are rejected by validator, skip them anyway
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		if _, ipnet, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, ipnet)
+		}
+	}
+
+	var ips []net.IP
+	for _, addr := range addrs {
+		if addr.flags&net.FlagUp == 0 || addr.flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if name != "" && addr.iface != name {
+			continue
+		}
+		if addr.ip.IsGlobalUnicast() == false {
+			continue
+		}
+		if ip := addr.ip.To4(); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			ips = append(ips, addr.ip)
+		}
+	}
+
+	// rank is lower if preferred
+	rank := func(ip net.IP) int {
+		r := len(nets) * 2
+		for i, ipnet := range nets {
+			if ipnet.Contains(ip) {
+				r = i * 2
+				break
+			}
+		}
+		if (ip.To4() == nil) != ipv6 {
+			r++
+		}
+		return r
+	}
+	sort.SliceStable(ips, func(i, j int) bool {
+		return rank(ips[i]) < rank(ips[j])
+	})
+	return ips
+}
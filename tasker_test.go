@@ -0,0 +1,64 @@
+package base
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestNeterValidate(t *testing.T) {
+	cases := []struct {
+		cidrs []string
+		ok    bool
+	}{
+		{nil, true},
+		{[]string{"10.0.0.0/8", "fd00::/8"}, true},
+		{[]string{"10.0.0.0/8", "10.0.0.0"}, false},
+		{[]string{"bad"}, false},
+	}
+	for _, c := range cases {
+		v := viper.New()
+		v.Set("ip.cidr", c.cidrs)
+		if err := neterValidate(v); (err == nil) != c.ok {
+			t.Errorf("neterValidate(%v) = %v, want ok %v", c.cidrs, err, c.ok)
+		}
+	}
+}
+
+func TestNeterRank(t *testing.T) {
+	up := net.FlagUp | net.FlagBroadcast
+	addrs := []neterAddr{
+		{"lo", up | net.FlagLoopback, net.ParseIP("127.0.0.1")},
+		{"lo", up | net.FlagLoopback, net.ParseIP("::1")},
+		{"eth0", up, net.ParseIP("fe80::1")},
+		{"eth0", up, net.ParseIP("10.0.0.5")},
+		{"eth0", up, net.ParseIP("2001:db8::5")},
+		{"eth0", up, net.ParseIP("192.168.1.5")},
+		{"eth1", up, net.ParseIP("169.254.1.1")},
+		{"eth1", up, net.ParseIP("172.16.0.9")},
+		{"docker0", net.FlagBroadcast, net.ParseIP("172.17.0.1")},
+	}
+
+	cases := []struct {
+		name  string
+		cidrs []string
+		ipv6  bool
+		ips   string
+	}{
+		{"", nil, false, "[10.0.0.5 192.168.1.5 172.16.0.9 2001:db8::5]"},
+		{"", nil, true, "[2001:db8::5 10.0.0.5 192.168.1.5 172.16.0.9]"},
+		{"", []string{"192.168.0.0/16", "10.0.0.0/8"}, false, "[192.168.1.5 10.0.0.5 172.16.0.9 2001:db8::5]"},
+		{"", []string{"2001:db8::/32"}, false, "[2001:db8::5 10.0.0.5 192.168.1.5 172.16.0.9]"},
+		{"", []string{"bad", "172.16.0.0/12"}, false, "[172.16.0.9 10.0.0.5 192.168.1.5 2001:db8::5]"},
+		{"eth1", nil, false, "[172.16.0.9]"},
+		{"eth0", []string{"192.168.0.0/16"}, true, "[192.168.1.5 2001:db8::5 10.0.0.5]"},
+		{"docker0", nil, false, "[]"},
+	}
+	for _, c := range cases {
+		if ips := fmt.Sprint(neterRank(addrs, c.name, c.cidrs, c.ipv6)); ips != c.ips {
+			t.Errorf("neterRank(%q, %v, %v) = %v, want %v", c.name, c.cidrs, c.ipv6, ips, c.ips)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// versionInfo is the content printed by `--version`
+type versionInfo struct {
+	App      string          `json:"app"`
+	Version  string          `json:"version"`
+	Path     string          `json:"path"`
+	Hash     string          `json:"hash"`
+	Time     string          `json:"time"`
+	Modified bool            `json:"modified"`
+	Go       string          `json:"go"`
+	Dir      string          `json:"dir,omitempty"`
+	Deps     []*debug.Module `json:"deps,omitempty"`
+}
+
+// buildInfoFill fill build information by runtime/debug.ReadBuildInfo,
+// values set by -ldflags take precedence
+func buildInfoFill() {
+	if buildGo == "" {
+		buildGo = runtime.Version()
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if ok == false {
+		return
+	}
+	buildPath = info.Main.Path
+	buildMain = info.Path
+	buildDeps = info.Deps
+	if version == "" {
+		version = info.Main.Version
+	}
+
+	var trimpath bool
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if buildHash == "" {
+				buildHash = setting.Value
+			}
+		case "vcs.time":
+			if buildTime == "" {
+				buildTime = setting.Value
+			}
+		case "vcs.modified":
+			buildModified = setting.Value == "true"
+		case "-trimpath":
+			trimpath = setting.Value == "true"
+		}
+	}
+
+	// Source paths start with module path if built with -trimpath
+	if buildDir == "" && trimpath == true {
+		buildDir = info.Main.Path
+	}
+}
+
+// versionFlag return format of `--version` parsed by flagSet
+func versionFlag() (string, bool) {
+	flag := flagSet.Lookup("version")
+	if flagSet.Parsed() == false || flag == nil || flag.Changed == false {
+		return "", false
+	}
+	return flag.Value.String(), true
+}
+
+// versionPrint print build information by format, text or json
+func versionPrint(format string) error {
+	info := versionInfo{
+		App:      GetAppName(),
+		Version:  GetVersion(),
+		Path:     GetBuildPath(),
+		Hash:     GetBuildHash(),
+		Time:     GetBuildTime(),
+		Modified: GetBuildModified(),
+		Go:       GetBuildGo(),
+		Dir:      GetBuildDir(),
+		Deps:     GetBuildDeps(),
+	}
+
+	switch format {
+	case "json":
+		buf, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(buf))
+	case "text", "":
+		fmt.Printf("%s %s\n", info.App, info.Version)
+		fmt.Printf("  path:     %s\n", info.Path)
+		fmt.Printf("  hash:     %s\n", info.Hash)
+		fmt.Printf("  time:     %s\n", info.Time)
+		fmt.Printf("  modified: %v\n", info.Modified)
+		fmt.Printf("  go:       %s\n", info.Go)
+		if 0 < len(info.Deps) {
+			fmt.Printf("  deps:\n")
+		}
+		for _, dep := range info.Deps {
+			if dep.Replace != nil {
+				fmt.Printf("    %s %s => %s %s\n", dep.Path, dep.Version, dep.Replace.Path, dep.Replace.Version)
+			} else {
+				fmt.Printf("    %s %s\n", dep.Path, dep.Version)
+			}
+		}
+	default:
+		return fmt.Errorf("Unknown version format: %s", format)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestVersionFlag(t *testing.T) {
+	fs := flagSet
+	defer func() { flagSet = fs }()
+
+	cases := []struct {
+		args   []string
+		format string
+		ok     bool
+	}{
+		{nil, "", false},
+		{[]string{"--version"}, "text", true},
+		{[]string{"--version=json"}, "json", true},
+		{[]string{"--version", "json"}, "text", true},
+		{[]string{"--host-flag", "--version=json"}, "json", true},
+		{[]string{"--", "--version"}, "", false},
+		{[]string{"serve", "--", "--version=json"}, "", false},
+	}
+	for _, c := range cases {
+		flagSet = newFlagSet()
+		if err := flagSet.Parse(flagArgs(c.args)); err != nil {
+			t.Fatal(err)
+		}
+		if format, ok := versionFlag(); format != c.format || ok != c.ok {
+			t.Errorf("versionFlag() of %v = %q, %v, want %q, %v", c.args, format, ok, c.format, c.ok)
+		}
+	}
+}
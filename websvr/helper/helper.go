@@ -3,11 +3,14 @@ package webhelper
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+
+	"github.com/miinowy/go-base"
 )
 
 // GinMiddleLogrus middleware use logrus to log requests
@@ -58,3 +61,35 @@ func GinHandlerRouterList(handler *gin.Engine) func(*gin.Context) {
 		c.String(200, string(buf))
 	}
 }
+
+// GinHandlerLogLevel return a gin handler that show log levels by GET, and
+// change log level temporarily by other methods with parameters:
+//
+//	level:    log level, revert to config if empty
+//	context:  context of tasks, global if empty
+//	duration: duration of the level, 10m by default
+func GinHandlerLogLevel() func(*gin.Context) {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			level, context := c.Request.FormValue("level"), c.Request.FormValue("context")
+			duration := 10 * time.Minute
+			if value := c.Request.FormValue("duration"); value != "" {
+				du, err := time.ParseDuration(value)
+				if err != nil {
+					c.String(400, err.Error())
+					return
+				}
+				duration = du
+			}
+
+			if level == "" {
+				base.ResetLogLevel(context)
+			} else if err := base.SetLogLevel(level, context, duration); err != nil {
+				c.String(400, err.Error())
+				return
+			}
+		}
+		buf, _ := json.MarshalIndent(base.GetLogLevels(), "", "  ")
+		c.String(200, string(buf))
+	}
+}
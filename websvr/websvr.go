@@ -16,6 +16,10 @@ var (
 	websvrMtx sync.Mutex
 )
 
+func init() {
+	base.DefaultRegister("websvr.<name>.listen", "", "Address to listen, web server is disabled if empty")
+}
+
 // Context provide web server
 // Handler will generate by handlerFunc every time on reload
 type Context struct {